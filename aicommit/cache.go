@@ -0,0 +1,75 @@
+package aicommit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CacheDirName is the directory inside the Git directory that holds cached
+// messages, one file per cache key.
+const CacheDirName = "ai-commit-cache"
+
+// cacheFile returns the cache file for the message generated from diff with
+// cfg. The key is a SHA-256 of the endpoint, model name, extra request
+// parameters (such as temperature) and the full prompt, which contains the
+// normalised diff as well as every prompt setting, so changing the provider,
+// style, language, etc. does not return a stale message. ok is false when
+// caching is disabled or there is no Git directory to hold the cache.
+func cacheFile(cfg Config, diff string) (file string, ok bool) {
+	if !cfg.Cache {
+		return "", false
+	}
+	gitDir, err := GitDir()
+	if err != nil {
+		return "", false
+	}
+	normalized := strings.TrimSpace(strings.ReplaceAll(diff, "\r\n", "\n"))
+	key := cfg.Endpoint + "\x00" + cfg.Model + "\x00" + string(cfg.ExtraParams) + "\x00" +
+		cfg.SystemPrompt + "\x00" + BuildPrompt(cfg, normalized)
+	if cfg.Seed != nil {
+		// A different seed asks for a different candidate.
+		key += "\x00seed=" + strconv.Itoa(*cfg.Seed)
+	}
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(gitDir, CacheDirName, hex.EncodeToString(sum[:])), true
+}
+
+// CachedMessage returns a previously generated message for diff if one
+// exists and is younger than the configured TTL.
+func CachedMessage(cfg Config, diff string) (string, bool) {
+	file, ok := cacheFile(cfg, diff)
+	if !ok {
+		return "", false
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		return "", false
+	}
+	if time.Since(info.ModTime()) > time.Duration(cfg.CacheTTLSeconds)*time.Second {
+		os.Remove(file)
+		return "", false
+	}
+	b, err := os.ReadFile(file)
+	if err != nil || len(b) == 0 {
+		return "", false
+	}
+	return string(b), true
+}
+
+// StoreMessage saves msg for later runs on the same diff. Failures are
+// ignored: the cache is an optimisation only.
+func StoreMessage(cfg Config, diff, msg string) {
+	file, ok := cacheFile(cfg, diff)
+	if !ok {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return
+	}
+	_ = os.WriteFile(file, []byte(msg), 0o644)
+}
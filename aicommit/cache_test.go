@@ -0,0 +1,83 @@
+package aicommit
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+)
+
+func cacheConfig() Config {
+	return Config{
+		Cache:           true,
+		CacheTTLSeconds: 60,
+		Endpoint:        "https://api.openai.com/v1/chat/completions",
+		Model:           "gpt-4o-mini",
+		Style:           "conventional",
+		SystemPrompt:    defaultSystemPrompt,
+	}
+}
+
+func TestCacheHitAndMiss(t *testing.T) {
+	newTestRepo(t)
+	const diff = "diff --git a/main.go b/main.go\n+package main\n"
+	StoreMessage(cacheConfig(), diff, "feat: add main package\n")
+
+	seven := 7
+	tests := []struct {
+		name   string
+		change func(*Config)
+		diff   string
+		hit    bool
+	}{
+		{"same diff", func(*Config) {}, diff, true},
+		{"CRLF and surrounding space", func(*Config) {}, "\n" + diff + "\r\n", true},
+		{"other diff", func(*Config) {}, diff + "+// more\n", false},
+		{"other model", func(c *Config) { c.Model = "gpt-4o" }, diff, false},
+		{"other endpoint", func(c *Config) { c.Endpoint = "http://localhost:11434/v1/chat/completions" }, diff, false},
+		{"other temperature", func(c *Config) { c.ExtraParams = json.RawMessage(`{"temperature":0.9}`) }, diff, false},
+		{"other seed", func(c *Config) { c.Seed = &seven }, diff, false},
+		{"other style", func(c *Config) { c.Style = "plain" }, diff, false},
+		{"cache disabled", func(c *Config) { c.Cache = false }, diff, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := cacheConfig()
+			tt.change(&cfg)
+			msg, ok := CachedMessage(cfg, tt.diff)
+			if ok != tt.hit {
+				t.Fatalf("hit = %v, want %v", ok, tt.hit)
+			}
+			if ok && msg != "feat: add main package\n" {
+				t.Errorf("message = %q", msg)
+			}
+		})
+	}
+}
+
+func TestCacheExpiry(t *testing.T) {
+	newTestRepo(t)
+	cfg := cacheConfig()
+	const diff = "diff --git a/main.go b/main.go\n+package main\n"
+	StoreMessage(cfg, diff, "feat: add main package\n")
+	file, ok := cacheFile(cfg, diff)
+	if !ok {
+		t.Fatal("no cache file")
+	}
+
+	old := time.Now().Add(-2 * time.Minute)
+	if err := os.Chtimes(file, old, old); err != nil {
+		t.Fatal(err)
+	}
+	cfg.CacheTTLSeconds = 300
+	if _, ok := CachedMessage(cfg, diff); !ok {
+		t.Fatal("entry younger than the TTL was not used")
+	}
+	cfg.CacheTTLSeconds = 60
+	if _, ok := CachedMessage(cfg, diff); ok {
+		t.Fatal("expired entry was used")
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("expired entry was not removed: %v", err)
+	}
+}
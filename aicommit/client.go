@@ -0,0 +1,501 @@
+package aicommit
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+type chatCompletionsRequest struct {
+	Model               string          `json:"model"`
+	Messages            []message       `json:"messages"`
+	ResponseFormat      *responseFormat `json:"response_format,omitempty"`
+	MaxCompletionTokens int             `json:"max_completion_tokens,omitempty"`
+	Seed                *int            `json:"seed,omitempty"`
+	Stop                []string        `json:"stop,omitempty"`
+}
+
+// responseFormat requests structured output that follows a JSON schema.
+type responseFormat struct {
+	Type       string         `json:"type"`
+	JSONSchema map[string]any `json:"json_schema"`
+}
+
+// commitMessageFormat is the response_format used by ai-commit.structured:
+// a subject line and a list of bullet points.
+var commitMessageFormat = &responseFormat{
+	Type: "json_schema",
+	JSONSchema: map[string]any{
+		"name":   "commit_message",
+		"strict": true,
+		"schema": map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"subject": map[string]any{"type": "string"},
+				"bullets": map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+			},
+			"required":             []string{"subject", "bullets"},
+			"additionalProperties": false,
+		},
+	},
+}
+
+// apiError is an HTTP error response from the LLM provider.
+type apiError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("LLM HTTP %d: %s", e.StatusCode, e.Message)
+}
+
+type message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type chatCompletionsResponse struct {
+	Choices []struct {
+		Message      message `json:"message"`
+		FinishReason string  `json:"finish_reason"`
+	} `json:"choices"`
+	Usage Usage `json:"usage"`
+	Error *struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+	} `json:"error,omitempty"`
+}
+
+// Usage is the usage object of a chat completions response. Providers
+// that don't report usage leave it zero.
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// add accumulates o into u, e.g. across a regeneration.
+func (u *Usage) add(o Usage) {
+	u.PromptTokens += o.PromptTokens
+	u.CompletionTokens += o.CompletionTokens
+	u.TotalTokens += o.TotalTokens
+}
+
+// encodeRequest marshals reqBody, renaming the "messages" field to
+// cfg.MessagesField for near-OpenAI schemas that expect e.g. "input", and
+// merging in cfg.ExtraParams, which win over fields set here.
+func encodeRequest(cfg Config, reqBody chatCompletionsRequest) ([]byte, error) {
+	b, err := json.Marshal(reqBody)
+	rename := cfg.MessagesField != "" && cfg.MessagesField != "messages"
+	if err != nil || !rename && len(cfg.ExtraParams) == 0 {
+		return b, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+	if rename {
+		fields[cfg.MessagesField] = fields["messages"]
+		delete(fields, "messages")
+	}
+	if len(cfg.ExtraParams) > 0 {
+		var extra map[string]json.RawMessage
+		if err := json.Unmarshal(cfg.ExtraParams, &extra); err != nil {
+			return nil, err
+		}
+		for k, v := range extra {
+			fields[k] = v
+		}
+	}
+	return json.Marshal(fields)
+}
+
+// parseExtraParams checks that ai-commit.extraParams is a JSON object and
+// does not replace the model or the messages (named messagesField), which
+// have settings of their own. It returns the object in compact form.
+func parseExtraParams(v, messagesField string) (json.RawMessage, error) {
+	var extra map[string]json.RawMessage
+	err := json.Unmarshal([]byte(v), &extra)
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	if err != nil || extra == nil {
+		return nil, errors.New("must be a JSON object, e.g. {\"top_p\": 0.9}")
+	}
+	if messagesField == "" {
+		messagesField = "messages"
+	}
+	for _, reserved := range []string{"model", messagesField} {
+		if _, ok := extra[reserved]; ok {
+			return nil, fmt.Errorf("may not set %q; it is filled in from the other ai-commit settings", reserved)
+		}
+	}
+	return json.Marshal(extra)
+}
+
+// errEmptyMessage is returned when the model answers with no content for no
+// stated reason (finish_reason empty or "stop"), which is usually transient.
+var errEmptyMessage = errors.New("LLM returned an empty message")
+
+// requestFieldName matches plausible JSON request field names.
+var requestFieldName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// CallChatCompletions sends prompt to the configured chat completions
+// endpoint and returns the raw content of the first choice.
+func CallChatCompletions(ctx context.Context, cfg Config, prompt string) (string, Usage, error) {
+	return requestChatCompletion(ctx, cfg, prompt, nil)
+}
+
+// requestChatCompletion sends prompt with an optional response_format and
+// returns the raw content of the first choice. When the endpoint fails and
+// ai-commit.fallbackEndpoint is set, the same request is sent there.
+func requestChatCompletion(ctx context.Context, cfg Config, prompt string, format *responseFormat) (string, Usage, error) {
+	content, usage, err := sendChatCompletion(ctx, cfg, prompt, format)
+	fallback, ok := FallbackConfig(cfg)
+	if err == nil || !ok || ctx.Err() != nil || !fallbackWorthy(err) {
+		return content, usage, err
+	}
+	if cfg.ConfirmRemote && !IsLocalEndpoint(fallback.Endpoint) && EndpointHost(fallback.Endpoint) != EndpointHost(cfg.Endpoint) {
+		// The user agreed to send the diff to the primary host only.
+		return "", usage, fmt.Errorf("%w (not trying fallback %s: ai-commit.confirmRemote is set)", err, EndpointHost(fallback.Endpoint))
+	}
+	fmt.Fprintf(os.Stderr, "git-ai-commit: warning: %s failed: %v\ngit-ai-commit: trying fallback %s (%s)\n", EndpointHost(cfg.Endpoint), err, fallback.Endpoint, fallback.Model)
+	content, more, ferr := sendChatCompletion(ctx, fallback, prompt, format)
+	usage.add(more)
+	if ferr != nil {
+		return "", usage, fmt.Errorf("%w; fallback %s also failed: %v", err, EndpointHost(fallback.Endpoint), ferr)
+	}
+	fmt.Fprintf(os.Stderr, "git-ai-commit: answered by fallback %s (%s)\n", fallback.Endpoint, fallback.Model)
+	return content, usage, nil
+}
+
+// FallbackConfig returns the configuration for ai-commit.fallbackEndpoint:
+// cfg with the fallback endpoint, model and API key. Provider-specific
+// settings (Azure style, custom headers, organization and project) are
+// dropped, since they belong to the primary endpoint. ok is false when no
+// fallback is configured.
+func FallbackConfig(cfg Config) (fallback Config, ok bool) {
+	if cfg.FallbackEndpoint == "" {
+		return cfg, false
+	}
+	fallback = cfg
+	fallback.APIStyle = "openai"
+	fallback.Endpoint = cfg.FallbackEndpoint
+	fallback.Model = cfg.FallbackModel
+	fallback.APIKey = cfg.FallbackAPIKey
+	fallback.Headers = nil
+	fallback.Organization = ""
+	fallback.Project = ""
+	fallback.HTTPClient = nil // the primary's client may dial a Unix socket
+	fallback.FallbackEndpoint = ""
+	return fallback, true
+}
+
+// fallbackWorthy reports whether err means the endpoint is unavailable
+// rather than that the request was wrong: only server errors and failures to
+// get a response at all qualify. A 4xx is about this request or account, so
+// the diff is not sent to a second provider for it; callers retry the ones
+// they can fix themselves (e.g. without response_format). Empty answers are
+// left to ai-commit.retryOnEmpty.
+func fallbackWorthy(err error) bool {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= http.StatusInternalServerError
+	}
+	return !errors.Is(err, errEmptyMessage)
+}
+
+// sendChatCompletion sends one request to cfg.Endpoint for
+// requestChatCompletion.
+func sendChatCompletion(ctx context.Context, cfg Config, prompt string, format *responseFormat) (content string, usage Usage, err error) {
+	// Servers sometimes echo credentials back in error bodies; never let the
+	// key escape through an error message.
+	defer func() { err = RedactError(err, cfg.APIKey) }()
+
+	if err := CheckAllowedHost(cfg.AllowedHosts, cfg.Endpoint); err != nil {
+		return "", usage, err
+	}
+
+	reqBody := chatCompletionsRequest{
+		Model: cfg.Model,
+		Messages: []message{
+			{Role: cfg.SystemRole, Content: cfg.SystemPrompt},
+			{Role: "user", Content: prompt},
+		},
+		ResponseFormat: format,
+		Seed:           cfg.Seed,
+		Stop:           cfg.Stop,
+	}
+	if cfg.MaxTokens > 0 {
+		reqBody.MaxCompletionTokens = cfg.MaxTokens
+	}
+
+	b, err := encodeRequest(cfg, reqBody)
+	if err != nil {
+		return "", usage, fmt.Errorf("marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", RequestURL(cfg.Endpoint), bytes.NewReader(b))
+	if err != nil {
+		return "", usage, fmt.Errorf("new request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	SetRequestHeaders(req, cfg)
+
+	client, err := httpClient(cfg)
+	if err != nil {
+		return "", usage, err
+	}
+
+	Debugf("POST %s (model %s, prompt %d bytes, request %d bytes)", cfg.Endpoint, cfg.Model, len(prompt), len(b))
+	for name, values := range req.Header {
+		for _, v := range values {
+			if sensitiveHeader(name) {
+				v = Redact(v)
+			}
+			Debugf("  %s: %s", name, redactText(v, cfg.APIKey))
+		}
+	}
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		Debugf("request failed after %s: %v", time.Since(start).Round(time.Millisecond), RedactError(err, cfg.APIKey))
+		return "", usage, fmt.Errorf("LLM request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	Debugf("HTTP %d in %s", resp.StatusCode, time.Since(start).Round(time.Millisecond))
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<20)) // cap 4MB
+
+	// An HTML page or plain text usually means the endpoint is not the API at
+	// all (a web UI port, a login page, a missing /v1), and the JSON parse
+	// error alone would be cryptic.
+	if ct := resp.Header.Get("Content-Type"); ct != "" && !isJSONContentType(ct) {
+		return "", usage, fmt.Errorf("LLM endpoint returned %s (HTTP %d) instead of JSON; check that ai-commit.endpoint points at the API (e.g. .../v1), not a web UI: %s",
+			ct, resp.StatusCode, Snippet(body, 200))
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		// Try to parse error shape; fall back to raw body.
+		var parsed chatCompletionsResponse
+		apiErr := &apiError{resp.StatusCode, strings.TrimSpace(string(body))}
+		if json.Unmarshal(body, &parsed) == nil && parsed.Error != nil && parsed.Error.Message != "" {
+			apiErr.Message = parsed.Error.Message
+		}
+		// Older OpenAI-compatible servers may reject the token cap outright;
+		// an uncapped request beats no message at all.
+		if reqBody.MaxCompletionTokens > 0 && resp.StatusCode == http.StatusBadRequest && strings.Contains(apiErr.Message, "max_completion_tokens") {
+			Debugf("max_completion_tokens rejected (%v); retrying without a token cap", apiErr)
+			cfg.MaxTokens = 0
+			return sendChatCompletion(ctx, cfg, prompt, format)
+		}
+		return "", usage, apiErr
+	}
+
+	var parsed chatCompletionsResponse
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return "", usage, fmt.Errorf("parse response: %w (body: %s)", err, strings.TrimSpace(string(body)))
+	}
+	if parsed.Error != nil && parsed.Error.Message != "" {
+		return "", usage, fmt.Errorf("LLM error: %s", parsed.Error.Message)
+	}
+	if len(parsed.Choices) == 0 {
+		return "", usage, errors.New("LLM response missing choices")
+	}
+
+	choice := parsed.Choices[0]
+	if strings.TrimSpace(choice.Message.Content) == "" {
+		// Reasoning models can spend the whole output budget thinking and
+		// return nothing; say why instead of a bare "empty message".
+		switch choice.FinishReason {
+		case "":
+			return "", parsed.Usage, errEmptyMessage
+		case "length":
+			return "", parsed.Usage, errors.New("LLM returned an empty message, finish_reason=length — the model ran out of output tokens (reasoning models may use them all before answering); try a non-reasoning model or raise ai-commit.maxTokens (0 removes the cap)")
+		case "content_filter":
+			return "", parsed.Usage, errors.New("LLM returned an empty message, finish_reason=content_filter — the provider's content filter blocked the response")
+		default:
+			return "", parsed.Usage, fmt.Errorf("%w, finish_reason=%s", errEmptyMessage, choice.FinishReason)
+		}
+	}
+	if choice.FinishReason == "length" {
+		Debugf("response was cut off (finish_reason=length)")
+	}
+	return choice.Message.Content, parsed.Usage, nil
+}
+
+// SetRequestHeaders adds authentication, attribution and user-configured
+// headers to a request for the LLM provider.
+func SetRequestHeaders(req *http.Request, cfg Config) {
+	if cfg.APIStyle == "azure" {
+		// Azure OpenAI authenticates with an api-key header, not Bearer.
+		req.Header.Set("api-key", cfg.APIKey)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+cfg.APIKey)
+	}
+	// Usage attribution for OpenAI; left out entirely when unset so other
+	// providers never see them.
+	if cfg.Organization != "" {
+		req.Header.Set("OpenAI-Organization", cfg.Organization)
+	}
+	if cfg.Project != "" {
+		req.Header.Set("OpenAI-Project", cfg.Project)
+	}
+
+	// User-configured headers are applied last so they take precedence over
+	// the defaults above, e.g. a custom Authorization header replaces Bearer.
+	for name, values := range cfg.Headers {
+		req.Header.Del(name)
+		for _, v := range values {
+			req.Header.Add(name, v)
+		}
+	}
+}
+
+// isJSONContentType reports whether a Content-Type header value denotes JSON,
+// including types such as application/problem+json.
+func isJSONContentType(ct string) bool {
+	mediaType, _, _ := strings.Cut(ct, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// Snippet returns the start of body as a single trimmed line of at most n
+// bytes, for error messages.
+func Snippet(body []byte, n int) string {
+	s := strings.Join(strings.Fields(string(body)), " ")
+	if len(s) > n {
+		s = s[:n] + "..."
+	}
+	return s
+}
+
+// httpClient returns cfg.HTTPClient, or a new client for cfg when it is unset.
+func httpClient(cfg Config) (*http.Client, error) {
+	if cfg.HTTPClient != nil {
+		return cfg.HTTPClient, nil
+	}
+	return NewHTTPClient(cfg)
+}
+
+// withHTTPClient sets cfg.HTTPClient if it is unset, so that the several
+// requests of one generation (chunk summaries, retries) share a transport
+// and its kept-alive connections.
+func withHTTPClient(cfg Config) (Config, error) {
+	client, err := httpClient(cfg)
+	cfg.HTTPClient = client
+	return cfg, err
+}
+
+// NewHTTPClient returns the client used for LLM requests. With no special
+// configuration it behaves like a bare http.Client, which honours the
+// HTTP_PROXY/HTTPS_PROXY/NO_PROXY environment variables. Timeouts are left to
+// the request context, except for the optional connect timeout. For a Unix
+// socket endpoint every connection dials the socket, bypassing any proxy.
+func NewHTTPClient(cfg Config) (*http.Client, error) {
+	socket, _, unix := SplitUnixEndpoint(cfg.Endpoint)
+	if cfg.Proxy == "" && cfg.CABundle == "" && !cfg.InsecureTLS && cfg.ConnectTimeoutSeconds == 0 && !unix {
+		return &http.Client{}, nil
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	// A short dial timeout makes a dead endpoint (e.g. Ollama not running)
+	// fail fast instead of using up the whole ai-commit.timeoutSeconds.
+	dialer := &net.Dialer{KeepAlive: 30 * time.Second}
+	if cfg.ConnectTimeoutSeconds > 0 {
+		dialer.Timeout = time.Duration(cfg.ConnectTimeoutSeconds) * time.Second
+		transport.DialContext = dialer.DialContext
+	}
+
+	switch {
+	case unix:
+		transport.Proxy = nil
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", socket)
+		}
+	case cfg.Proxy == "":
+		// Keep the environment-derived proxy from the default transport.
+	case strings.EqualFold(cfg.Proxy, "none"):
+		// Bypass any proxy configured in the environment.
+		transport.Proxy = nil
+	default:
+		u, err := parseProxyURL(cfg.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ai-commit.proxy %q: %w", cfg.Proxy, err)
+		}
+		transport.Proxy = http.ProxyURL(u)
+	}
+
+	if cfg.CABundle != "" || cfg.InsecureTLS {
+		tlsCfg := &tls.Config{InsecureSkipVerify: cfg.InsecureTLS}
+		if cfg.CABundle != "" {
+			pool, err := loadCertPool(cfg.CABundle)
+			if err != nil {
+				return nil, err
+			}
+			tlsCfg.RootCAs = pool
+		}
+		transport.TLSClientConfig = tlsCfg
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
+
+// loadCertPool returns the system certificate pool with the PEM certificates
+// from path appended, so a private CA is trusted in addition to public ones.
+func loadCertPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("ai-commit.caBundle: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("ai-commit.caBundle: no PEM certificates found in %s", path)
+	}
+	return pool, nil
+}
+
+// parseProxyURL parses a proxy URL, defaulting to http:// when no scheme is
+// given (matching how HTTP_PROXY values are commonly written).
+func parseProxyURL(raw string) (*url.URL, error) {
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" {
+		return nil, errors.New("proxy URL has no host")
+	}
+	return u, nil
+}
+
+// Verbose enables debug logging to stderr; set by --verbose or AI_COMMIT_DEBUG.
+var Verbose = os.Getenv("AI_COMMIT_DEBUG") != ""
+
+// Debugf logs to stderr when verbose output is enabled. Callers must redact
+// secrets themselves.
+func Debugf(format string, args ...any) {
+	if Verbose {
+		fmt.Fprintf(os.Stderr, "git-ai-commit: debug: "+format+"\n", args...)
+	}
+}
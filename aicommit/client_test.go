@@ -0,0 +1,342 @@
+package aicommit
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// clientConfig returns a minimal configuration that sends requests to srv.
+func clientConfig(srv *httptest.Server) Config {
+	return Config{
+		Endpoint:   srv.URL + "/v1/chat/completions",
+		Model:      "test-model",
+		SystemRole: "system",
+	}
+}
+
+// writeChoice answers a chat completions request with a single choice.
+func writeChoice(w http.ResponseWriter, content, finishReason string) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"choices": []map[string]any{{
+			"message":       map[string]string{"role": "assistant", "content": content},
+			"finish_reason": finishReason,
+		}},
+	})
+}
+
+// writeError answers with an OpenAI-style error body and status.
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{"error": map[string]string{"message": msg}})
+}
+
+func TestFallbackEndpoint(t *testing.T) {
+	var fallbackCalls atomic.Int32
+	fallback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fallbackCalls.Add(1)
+		var req chatCompletionsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("decode fallback request: %v", err)
+		}
+		if req.Model != "fallback-model" {
+			t.Errorf("fallback got model %q, want fallback-model", req.Model)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer fallback-key" {
+			t.Errorf("fallback got Authorization %q", got)
+		}
+		writeChoice(w, "fix: from fallback", "stop")
+	}))
+	defer fallback.Close()
+
+	refused := httptest.NewServer(http.NotFoundHandler())
+	refusedURL := refused.URL
+	refused.Close()
+
+	tests := []struct {
+		name         string
+		status       int // primary response; 0 means the connection is refused
+		wantFallback bool
+	}{
+		{"server error", http.StatusInternalServerError, true},
+		{"bad gateway", http.StatusBadGateway, true},
+		{"connection refused", 0, true},
+		{"bad request", http.StatusBadRequest, false},
+		{"unauthorized", http.StatusUnauthorized, false},
+		{"not found", http.StatusNotFound, false},
+		{"rate limited", http.StatusTooManyRequests, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fallbackCalls.Store(0)
+			primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				writeError(w, tt.status, "primary failed")
+			}))
+			defer primary.Close()
+
+			cfg := clientConfig(primary)
+			cfg.APIKey = "primary-key"
+			if tt.status == 0 {
+				cfg.Endpoint = refusedURL + "/v1/chat/completions"
+			}
+			cfg.FallbackEndpoint = fallback.URL + "/v1/chat/completions"
+			cfg.FallbackModel = "fallback-model"
+			cfg.FallbackAPIKey = "fallback-key"
+
+			got, _, err := CallChatCompletions(context.Background(), cfg, "prompt")
+			if n := fallbackCalls.Load(); (n == 1) != tt.wantFallback || n > 1 {
+				t.Fatalf("fallback called %d times, want fallback %v", n, tt.wantFallback)
+			}
+			if tt.wantFallback {
+				if err != nil {
+					t.Fatalf("CallChatCompletions: %v", err)
+				}
+				if got != "fix: from fallback" {
+					t.Errorf("content = %q, want the fallback's answer", got)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), "primary failed") {
+				t.Errorf("error = %v, want the primary's error", err)
+			}
+		})
+	}
+}
+
+func TestFallbackBothFail(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusServiceUnavailable, "overloaded")
+	}))
+	defer failing.Close()
+
+	cfg := clientConfig(failing)
+	cfg.FallbackEndpoint = failing.URL + "/v1/chat/completions"
+	cfg.FallbackModel = cfg.Model
+	_, _, err := CallChatCompletions(context.Background(), cfg, "prompt")
+	if err == nil || !strings.Contains(err.Error(), "fallback 127.0.0.1") || !strings.Contains(err.Error(), "also failed") {
+		t.Errorf("error = %v, want both failures", err)
+	}
+}
+
+func TestTLSConfig(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeChoice(w, "fix: over tls", "stop")
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	bundle := filepath.Join(dir, "ca.pem")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(bundle, cert, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	notPEM := filepath.Join(dir, "empty.pem")
+	if err := os.WriteFile(notPEM, []byte("not a certificate\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		caBundle string
+		insecure bool
+		wantErr  string
+	}{
+		{"untrusted", "", false, "certificate"},
+		{"ca bundle", bundle, false, ""},
+		{"insecure", "", true, ""},
+		{"missing bundle", filepath.Join(dir, "missing.pem"), false, "ai-commit.caBundle:"},
+		{"bundle without certificates", notPEM, false, "ai-commit.caBundle: no PEM certificates found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := clientConfig(srv)
+			cfg.CABundle = tt.caBundle
+			cfg.InsecureTLS = tt.insecure
+			got, _, err := CallChatCompletions(context.Background(), cfg, "prompt")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != "fix: over tls" {
+				t.Errorf("content = %q", got)
+			}
+		})
+	}
+}
+
+func TestNonJSONResponse(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		status      int
+		body        string
+		wantErr     string
+	}{
+		{"html page", "text/html; charset=utf-8", http.StatusOK, "<!doctype html><title>Open WebUI</title>", "LLM endpoint returned text/html; charset=utf-8 (HTTP 200) instead of JSON"},
+		{"html error", "text/html", http.StatusNotFound, "<h1>404 Not Found</h1>", "(HTTP 404) instead of JSON; check that ai-commit.endpoint points at the API"},
+		{"plain text", "text/plain", http.StatusBadGateway, "upstream connect error", "text/plain (HTTP 502) instead of JSON"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			_, _, err := CallChatCompletions(context.Background(), clientConfig(srv), "prompt")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), strings.TrimPrefix(tt.body, "<!doctype html>")) {
+				t.Errorf("error lacks a snippet of the body: %v", err)
+			}
+		})
+	}
+}
+
+func TestJSONContentTypes(t *testing.T) {
+	for _, ct := range []string{"application/json", "application/json; charset=utf-8", "APPLICATION/JSON", "application/problem+json"} {
+		t.Run(ct, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", ct)
+				w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"fix: ok"}}]}`))
+			}))
+			defer srv.Close()
+
+			got, _, err := CallChatCompletions(context.Background(), clientConfig(srv), "prompt")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != "fix: ok" {
+				t.Errorf("content = %q", got)
+			}
+		})
+	}
+}
+
+func TestEmptyContentFinishReason(t *testing.T) {
+	tests := []struct {
+		finishReason string
+		wantErr      string
+		wantEmpty    bool // errors.Is(err, errEmptyMessage)
+	}{
+		{"length", "finish_reason=length — the model ran out of output tokens", false},
+		{"content_filter", "finish_reason=content_filter — the provider's content filter blocked the response", false},
+		{"stop", "LLM returned an empty message, finish_reason=stop", true},
+		{"", "LLM returned an empty message", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.finishReason, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				writeChoice(w, "  \n", tt.finishReason)
+			}))
+			defer srv.Close()
+
+			_, _, err := CallChatCompletions(context.Background(), clientConfig(srv), "prompt")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+			if errors.Is(err, errEmptyMessage) != tt.wantEmpty {
+				t.Errorf("errors.Is(err, errEmptyMessage) = %v, want %v", !tt.wantEmpty, tt.wantEmpty)
+			}
+		})
+	}
+}
+
+func TestTruncatedContentIsKept(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeChoice(w, "feat: add a very long subject that got cut", "length")
+	}))
+	defer srv.Close()
+
+	got, _, err := CallChatCompletions(context.Background(), clientConfig(srv), "prompt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "feat: add a very long subject that got cut" {
+		t.Errorf("content = %q", got)
+	}
+}
+
+// rawRequest sends one chat completions request for cfg and returns the
+// JSON object the server received.
+func rawRequest(t *testing.T, cfg Config) map[string]json.RawMessage {
+	t.Helper()
+	bodies := make(chan map[string]json.RawMessage, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		bodies <- body
+		writeChoice(w, "fix: ok", "stop")
+	}))
+	defer srv.Close()
+
+	endpoint := clientConfig(srv).Endpoint
+	cfg.Endpoint = endpoint
+	if _, _, err := CallChatCompletions(context.Background(), cfg, "prompt"); err != nil {
+		t.Fatal(err)
+	}
+	return <-bodies
+}
+
+func TestStopSequences(t *testing.T) {
+	tests := []struct {
+		name string
+		stop []string
+		want string // "" means the field is omitted
+	}{
+		{"unset", nil, ""},
+		{"one", []string{"```"}, `["` + "```" + `"]`},
+		{"several", []string{"\n\n\n", "END", `"quoted"`}, `["\n\n\n","END","\"quoted\""]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := rawRequest(t, Config{Model: "m", SystemRole: "system", Stop: tt.stop})
+			got, ok := body["stop"]
+			if tt.want == "" {
+				if ok {
+					t.Errorf("stop = %s, want it omitted", got)
+				}
+				return
+			}
+			if string(got) != tt.want {
+				t.Errorf("stop = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSystemRole(t *testing.T) {
+	for _, role := range []string{"system", "developer"} {
+		t.Run(role, func(t *testing.T) {
+			body := rawRequest(t, Config{Model: "m", SystemRole: role, SystemPrompt: "You write commit messages."})
+			var messages []message
+			if err := json.Unmarshal(body["messages"], &messages); err != nil {
+				t.Fatal(err)
+			}
+			want := []message{{Role: role, Content: "You write commit messages."}, {Role: "user", Content: "prompt"}}
+			if len(messages) != 2 || messages[0] != want[0] || messages[1] != want[1] {
+				t.Errorf("messages = %+v, want %+v", messages, want)
+			}
+		})
+	}
+}
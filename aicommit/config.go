@@ -0,0 +1,1029 @@
+package aicommit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config is the resolved configuration for generating messages. ReadConfig
+// builds it from git config, the environment and command-line overrides.
+type Config struct {
+	APIStyle              string // "openai" (default) or "azure"
+	Profile               string // active profile from --profile or ai-commit.profile; empty for none
+	MessagesField         string // request field holding the messages (ai-commit.messagesField)
+	SystemRole            string // role of the first message: "system" (default) or "developer"
+	Endpoint              string
+	Model                 string
+	APIKey                string
+	APIKeySource          string // where APIKey came from, for diagnostics
+	FallbackEndpoint      string // chat completions URL tried when Endpoint fails; empty for none
+	FallbackModel         string // model for FallbackEndpoint; defaults to Model
+	FallbackAPIKey        string // resolved ai-commit.fallbackApiKey
+	MaxDiffBytes          int
+	Chunked               bool // summarize large diffs in parts before writing the message
+	ChunkBytes            int  // largest diff sent in one request in chunked mode
+	TimeoutSeconds        int
+	ConnectTimeoutSeconds int  // dial timeout for the LLM endpoint; 0 keeps the default
+	MaxTokens             int  // completion token cap; 0 is unbounded, -1 (unset) derives one for commit messages
+	Seed                  *int // sampling seed sent as "seed"; nil leaves it out
+	IncludeUntracked      bool // append untracked files to the staged diff
+	IncludeStat           bool // start the diff with a git diff --stat summary
+	TextOnly              bool // list binary files by name instead of sending their diff sections
+	SkipWhitespaceOnly    bool // use WhitespaceOnlyMessage instead of the model for whitespace-only changes
+	RedactSecrets         bool // mask likely secrets in the diff before sending it
+	Cache                 bool // reuse messages for an unchanged diff (ai-commit.cache)
+	CacheTTLSeconds       int
+	Fallback              string // hook message when generation fails: "none" or "filelist"
+	SubjectMaxLen         int    // ai-commit.subjectMaxLength
+	Style                 string // "conventional" (default) or "plain"
+	IncludeBody           bool   // ask for a bullet-point body after the subject
+	WrapBody              bool   // hard-wrap body lines at WrapWidth
+	WrapWidth             int
+	Structured            bool             // request JSON output via response_format
+	RetryOnEmpty          bool             // ask once more when the model returns an empty message
+	BaseBranch            string           // branch that pr diffs against
+	PRIncludeStat         bool             // append a collapsed diff stat to pr output
+	BodyThresholdLines    int              // single-file diffs with fewer changed lines get a subject only
+	Gitmoji               bool             // prefix subjects with the gitmoji for their type
+	ExtraTypes            []string         // Conventional Commits types allowed besides the built-in ones
+	EnforceType           bool             // regenerate once when the subject type is not allowed
+	FixImperative         bool             // rewrite a past-tense or gerund first word of the subject ("Added" → "Add")
+	Scopes                []string         // allowed Conventional Commits scopes; empty means any
+	HistoryCount          int              // number of recent commit subjects shown to the model as style examples
+	History               []string         // those subjects; read from git log by withHistory when needed
+	Language              string           // language for the generated message; empty means English
+	SystemPrompt          string           // system message sent with every request
+	CoAuthors             []string         // "Name <email>" entries appended as Co-authored-by trailers
+	Headers               http.Header      // extra request headers from ai-commit.header.*
+	Organization          string           // sent as OpenAI-Organization when set
+	Project               string           // sent as OpenAI-Project when set
+	UsageLog              string           // file that token usage is appended to, one JSON line per message
+	PriceInputPer1k       float64          // USD per 1K prompt tokens; overrides modelPrices
+	PriceOutputPer1k      float64          // USD per 1K completion tokens; overrides modelPrices
+	Proxy                 string           // proxy URL, "none", or empty for HTTP(S)_PROXY from the environment
+	BannedPhrases         []string         // phrases that trigger a regeneration when present in the output
+	Stop                  []string         // stop sequences sent as "stop" (ai-commit.stop)
+	ExtraParams           json.RawMessage  // JSON object merged into every request body (ai-commit.extraParams)
+	StripDisclaimers      bool             // remove trailing model disclaimers (ai-commit.stripDisclaimers)
+	DisclaimerPatterns    []*regexp.Regexp // default plus ai-commit.disclaimerPattern entries
+	CABundle              string           // PEM file appended to the system cert pool
+	InsecureTLS           bool             // skip TLS certificate verification (ai-commit.insecureSkipVerify)
+	ConfirmRemote         bool             // ask before sending a diff to a non-local endpoint
+	AllowedHosts          []string         // hosts the tool may contact; empty allows any
+	MarkerTrailer         bool             // append an X-AI-Commit trailer naming the model
+	StripMarker           bool             // remove X-AI-Commit trailers before writing the message
+	HTTPClient            *http.Client     // sends LLM requests when set, e.g. an httptest client; nil uses NewHTTPClient
+}
+
+// String implements fmt.Stringer so that printing a config (e.g. with %v or
+// %+v in diagnostics) never reveals the API key.
+func (c Config) String() string {
+	type plain Config // drop the String method to avoid recursion
+	p := plain(c)
+	p.APIKey = Redact(c.APIKey)
+	p.FallbackAPIKey = Redact(c.FallbackAPIKey)
+	// Custom headers often carry tokens too.
+	if c.Headers != nil {
+		p.Headers = http.Header{}
+		for name, values := range c.Headers {
+			for _, v := range values {
+				p.Headers.Add(name, Redact(v))
+			}
+		}
+	}
+	return fmt.Sprintf("%+v", p)
+}
+
+// DiffLimit is the size a diff for a commit message is truncated to:
+// MaxDiffBytes, or no limit in chunked mode, where summarizeDiff sends the
+// whole diff in parts and only caps each file at ChunkBytes.
+func (c Config) DiffLimit() int {
+	if c.Chunked {
+		return 0
+	}
+	return c.MaxDiffBytes
+}
+
+// envFileVars records the variables loadEnvFile set, so that ReadConfig can
+// tell them apart from the real environment.
+var envFileVars = map[string]bool{}
+
+// loadEnvFile loads KEY=VALUE pairs from ai-commit.envFile into the process
+// environment so they can feed AI_COMMIT_* overrides and $ENV_VAR API keys.
+// Nothing is loaded unless the user's own git config names the file: a
+// .env committed to a cloned repository must not be able to redirect diffs
+// or run commands. For the same reason, variables that choose where requests
+// go or which programs run (see envFileBlocked) are ignored even from a
+// configured file. Relative paths are resolved against the repository root;
+// "none" disables loading. Variables that are already set are never
+// overwritten, and values are never logged.
+func loadEnvFile() error {
+	file, ok := GitConfigGet("ai-commit.envFile")
+	file = ExpandHome(strings.TrimSpace(file))
+	if !ok || file == "" || strings.EqualFold(file, "none") {
+		return nil
+	}
+	if !filepath.IsAbs(file) {
+		root, err := getRepoRoot()
+		if err != nil {
+			root = "."
+		}
+		file = filepath.Join(root, file)
+	}
+
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("ai-commit.envFile: %w", err)
+	}
+
+	loaded := 0
+	for n, line := range strings.Split(strings.ReplaceAll(string(b), "\r\n", "\n"), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return fmt.Errorf("%s:%d: expected KEY=VALUE", file, n+1)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		if envFileBlocked(key) {
+			fmt.Fprintf(os.Stderr, "git-ai-commit: warning: ignoring %s from %s; set it in git config or the real environment\n", key, file)
+			continue
+		}
+		if _, set := os.LookupEnv(key); set {
+			continue
+		}
+		os.Setenv(key, value)
+		envFileVars[key] = true
+		loaded++
+	}
+	Debugf("loaded %d variable(s) from %s", loaded, file)
+	return nil
+}
+
+// envFileBlocked reports whether an env file may not set the variable name:
+// the connection overrides (endpoint, profile, git binary), proxy and TLS
+// trust settings, and variables that change which programs git and sh run.
+func envFileBlocked(name string) bool {
+	upper := strings.ToUpper(name)
+	switch upper {
+	case "AI_COMMIT_ENDPOINT", "AI_COMMIT_PROFILE", "AI_COMMIT_GIT",
+		"PATH", "HOME", "ENV", "BASH_ENV", "SHELL", "EDITOR", "VISUAL", "PAGER", "SSH_ASKPASS",
+		"SSL_CERT_FILE", "SSL_CERT_DIR":
+		return true
+	}
+	return strings.HasSuffix(upper, "_PROXY") ||
+		strings.HasPrefix(upper, "GIT_") ||
+		strings.HasPrefix(upper, "LD_") ||
+		strings.HasPrefix(upper, "DYLD_")
+}
+
+// configEnvVars maps config keys to environment variables that override them,
+// so the tool can be configured without any git config (e.g. in CI).
+// Precedence, highest first: command-line flags, these environment variables,
+// the active profile, local git config, RepoConfigFileName, global and system
+// git config, built-in defaults.
+var configEnvVars = map[string]string{
+	"ai-commit.endpoint":       "AI_COMMIT_ENDPOINT",
+	"ai-commit.model":          "AI_COMMIT_MODEL",
+	"ai-commit.apiKey":         "AI_COMMIT_API_KEY",
+	"ai-commit.maxDiffBytes":   "AI_COMMIT_MAX_DIFF_BYTES",
+	"ai-commit.timeoutSeconds": "AI_COMMIT_TIMEOUT_SECONDS",
+	"ai-commit.profile":        "AI_COMMIT_PROFILE",
+	"ai-commit.gitBinary":      "AI_COMMIT_GIT",
+	"ai-commit.failOpen":       "AI_COMMIT_FAIL_OPEN",
+	"ai-commit.bannedPhrases":  "AI_COMMIT_BANNED_PHRASES",
+}
+
+// configFromEnv returns the environment override for key, if one is set and
+// non-empty.
+func configFromEnv(key string) (string, bool) {
+	name, ok := configEnvVars[key]
+	if !ok {
+		return "", false
+	}
+	v := os.Getenv(name)
+	return v, v != ""
+}
+
+// activeProfile is the profile selected by --profile or ai-commit.profile,
+// set by ReadConfig. Its ai-commit.profiles.<name>.* keys take precedence
+// over the plain ai-commit.* ones.
+var activeProfile string
+
+// profileKey returns the active profile's variant of an ai-commit.* key, or
+// "" when no profile is selected.
+func profileKey(key string) string {
+	name, ok := strings.CutPrefix(key, "ai-commit.")
+	if activeProfile == "" || !ok {
+		return ""
+	}
+	return "ai-commit.profiles." + activeProfile + "." + name
+}
+
+// ConfigGet looks up a single-valued setting, consulting the environment
+// override, the active profile, and the repository's RepoConfigFileName
+// before git config.
+func ConfigGet(key string) (string, bool) {
+	if v, ok := configFromEnv(key); ok {
+		return v, true
+	}
+	if pk := profileKey(key); pk != "" {
+		if v, ok := GitConfigGet(pk); ok {
+			return v, true
+		}
+	}
+	if v, ok := repoConfigGet(key); ok {
+		return v, true
+	}
+	return GitConfigGet(key)
+}
+
+// ConfigBool looks up a boolean setting like ConfigGet, using Git's boolean
+// rules for git config values.
+func ConfigBool(key string) (value bool, ok bool) {
+	if v, ok := configFromEnv(key); ok {
+		if b, ok := parseBool(v); ok {
+			return b, true
+		}
+	}
+	if pk := profileKey(key); pk != "" {
+		if v, ok := GitConfigBool(pk); ok {
+			return v, true
+		}
+	}
+	return GitConfigBool(key)
+}
+
+// configGetAll looks up a multi-valued setting: the environment override as
+// a single value, else the active profile's values, else git config's. A
+// profile's values replace the plain ones rather than adding to them.
+func configGetAll(key string) []string {
+	if v, ok := configFromEnv(key); ok {
+		return []string{v}
+	}
+	if pk := profileKey(key); pk != "" {
+		if values := gitConfigGetAll(pk); len(values) > 0 {
+			return values
+		}
+	}
+	return gitConfigGetAll(key)
+}
+
+// FailOpen reports whether a failed prepare-commit-msg hook should still let
+// the commit go ahead (ai-commit.failOpen, default true). It resolves the
+// profile itself, from profile or else AI_COMMIT_PROFILE and
+// ai-commit.profile, so the answer does not depend on ReadConfig having
+// succeeded. RepoConfigFileName cannot set it: a cloned repository must not
+// be able to block commits.
+func FailOpen(profile string) bool {
+	if v, ok := configFromEnv("ai-commit.failOpen"); ok {
+		if b, ok := parseBool(v); ok {
+			return b
+		}
+	}
+	if profile == "" {
+		if v, ok := configFromEnv("ai-commit.profile"); ok {
+			profile = v
+		} else {
+			profile, _ = GitConfigGet("ai-commit.profile")
+		}
+	}
+	if profile = strings.TrimSpace(profile); profile != "" {
+		if b, ok := GitConfigBool("ai-commit.profiles." + profile + ".failOpen"); ok {
+			return b
+		}
+	}
+	if b, ok := GitConfigBool("ai-commit.failOpen"); ok {
+		return b
+	}
+	return true
+}
+
+// parseBool accepts the spellings Git accepts for a boolean value.
+func parseBool(v string) (value bool, ok bool) {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "true", "yes", "on", "1":
+		return true, true
+	case "false", "no", "off", "0":
+		return false, true
+	}
+	return false, false
+}
+
+// Overrides holds per-invocation values from command-line flags. They
+// take precedence over git config.
+type Overrides struct {
+	Profile  string // --profile; selects ai-commit.profiles.<name>.*
+	Model    string
+	Endpoint string // unresolved base URL, normalised like ai-commit.endpoint
+	Body     string // "subject" (--subject-only) or "full" (--full); "" uses config
+	Offline  bool   // the caller never contacts the model, so ai-commit.apiKey is not resolved
+}
+
+// selectProfile sets activeProfile from the --profile flag or
+// ai-commit.profile, and checks that the profile has at least one key.
+func selectProfile(name string) error {
+	activeProfile = ""
+	if name == "" {
+		name, _ = ConfigGet("ai-commit.profile")
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil
+	}
+	if len(gitConfigGetRegexp(`^ai-commit\.profiles\.`+regexp.QuoteMeta(name)+`\.`)) == 0 {
+		return fmt.Errorf("unknown profile %q: no ai-commit.profiles.%s.* keys are set", name, name)
+	}
+	activeProfile = name
+	Debugf("using profile %s", name)
+	return nil
+}
+
+// ReadConfig resolves the configuration for the current repository: built-in
+// defaults, then git config (with RepoConfigFileName and the active profile
+// layered in), then AI_COMMIT_* environment variables, then ov.
+func ReadConfig(ov Overrides) (Config, error) {
+	if err := loadEnvFile(); err != nil {
+		return Config{}, err
+	}
+	if err := selectProfile(ov.Profile); err != nil {
+		return Config{}, err
+	}
+	if err := loadRepoConfig(); err != nil {
+		return Config{}, err
+	}
+
+	cfg := Config{
+		Profile:          activeProfile,
+		APIStyle:         "openai",
+		SystemRole:       "system",
+		Endpoint:         "https://api.openai.com/v1",
+		Model:            "gpt-5-nano",
+		MaxDiffBytes:     200_000,
+		ChunkBytes:       32_000,
+		TimeoutSeconds:   30,
+		MaxTokens:        -1,
+		Cache:            true,
+		RedactSecrets:    true,
+		TextOnly:         true,
+		CacheTTLSeconds:  24 * 60 * 60,
+		Fallback:         "none",
+		SubjectMaxLen:    72,
+		Style:            "conventional",
+		BaseBranch:       "main",
+		SystemPrompt:     defaultSystemPrompt,
+		IncludeBody:      true,
+		WrapWidth:        72,
+		RetryOnEmpty:     true,
+		StripDisclaimers: true,
+	}
+
+	if v, ok := ConfigGet("ai-commit.endpoint"); ok && strings.TrimSpace(v) != "" {
+		cfg.Endpoint = strings.TrimSpace(v)
+	}
+	if v, ok := ConfigGet("ai-commit.model"); ok {
+		cfg.Model = strings.TrimSpace(v)
+	}
+	if ov.Endpoint != "" {
+		cfg.Endpoint = strings.TrimSpace(ov.Endpoint)
+	}
+	if ov.Model != "" {
+		cfg.Model = ov.Model
+	}
+
+	if cfg.Endpoint == "" {
+		return cfg, errors.New("missing git config: ai-commit.endpoint (set to base URL, e.g. https://api.openai.com/v1)")
+	}
+	if cfg.Model == "" {
+		// local endpoints may be ok with no model provided...
+	}
+
+	// Normalise: resolve to the canonical /chat/completions URL,
+	// handling any combination of trailing slashes, existing /v1, etc.
+	// We do this before resolving the API key so that git-credentials can use
+	// the normalised endpoint URL.
+	if v, ok := ConfigGet("ai-commit.apiStyle"); ok && strings.TrimSpace(v) != "" {
+		cfg.APIStyle = strings.ToLower(strings.TrimSpace(v))
+	}
+	switch cfg.APIStyle {
+	case "openai":
+		rawEndpoint, _ := ConfigBool("ai-commit.rawEndpoint")
+		resolved, err := resolveChatCompletionsEndpoint(cfg.Endpoint, rawEndpoint)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid ai-commit.endpoint %q: %w", cfg.Endpoint, err)
+		}
+		cfg.Endpoint = resolved
+	case "azure":
+		deployment, _ := ConfigGet("ai-commit.azureDeployment")
+		apiVersion := "2024-10-21"
+		if v, ok := ConfigGet("ai-commit.azureApiVersion"); ok && strings.TrimSpace(v) != "" {
+			apiVersion = strings.TrimSpace(v)
+		}
+		resolved, err := resolveAzureEndpoint(cfg.Endpoint, strings.TrimSpace(deployment), apiVersion)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid azure configuration: %w", err)
+		}
+		cfg.Endpoint = resolved
+	default:
+		return cfg, fmt.Errorf("unknown ai-commit.apiStyle %q (expected openai or azure)", cfg.APIStyle)
+	}
+
+	if v, ok := ConfigGet("ai-commit.maxDiffBytes"); ok {
+		if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && n > 0 {
+			cfg.MaxDiffBytes = n
+		}
+	}
+	if v, ok := ConfigGet("ai-commit.timeoutSeconds"); ok {
+		if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && n > 0 {
+			cfg.TimeoutSeconds = n
+		}
+	}
+
+	// A broken credential helper must not stall the commit; 0 waits forever.
+	credentialTimeout := defaultCredentialTimeout
+	if v, ok := ConfigGet("ai-commit.credentialTimeoutSeconds"); ok {
+		if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && n >= 0 {
+			credentialTimeout = time.Duration(n) * time.Second
+		}
+	}
+
+	// Resolve the API key — may be a literal value, an env-var reference, a
+	// file, a command, or the special token "git-credentials". This comes
+	// after timeoutSeconds so an exec: command is bounded by it.
+	cfg.APIKeySource = "unset"
+	if rawKey, ok := ConfigGet("ai-commit.apiKey"); ok && !ov.Offline {
+		rawKey = strings.TrimSpace(rawKey)
+		cfg.APIKeySource = apiKeySource(rawKey)
+		if _, fromEnv := configFromEnv("ai-commit.apiKey"); fromEnv {
+			cfg.APIKeySource = "environment variable AI_COMMIT_API_KEY"
+			if envFileVars["AI_COMMIT_API_KEY"] && (strings.HasPrefix(rawKey, "exec:") || strings.HasPrefix(rawKey, "file:")) {
+				return cfg, errors.New("AI_COMMIT_API_KEY: exec: and file: keys are not accepted from ai-commit.envFile; set them in git config")
+			}
+		}
+		key, err := resolveAPIKey(rawKey, cfg.Endpoint, time.Duration(cfg.TimeoutSeconds)*time.Second, credentialTimeout)
+		if err != nil {
+			return cfg, fmt.Errorf("ai-commit.apiKey: %w", err)
+		}
+		cfg.APIKey = key
+	}
+	// If ai-commit.apiKey is not set at all we leave cfg.APIKey empty;
+	// local endpoints (Ollama, LM Studio) work fine without one.
+
+	// The fallback gets its own key, never the primary one: it is usually
+	// another provider.
+	if v, ok := ConfigGet("ai-commit.fallbackEndpoint"); ok && strings.TrimSpace(v) != "" {
+		resolved, err := resolveChatCompletionsEndpoint(strings.TrimSpace(v), false)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid ai-commit.fallbackEndpoint %q: %w", strings.TrimSpace(v), err)
+		}
+		cfg.FallbackEndpoint = resolved
+		cfg.FallbackModel = cfg.Model
+		if v, ok := ConfigGet("ai-commit.fallbackModel"); ok && strings.TrimSpace(v) != "" {
+			cfg.FallbackModel = strings.TrimSpace(v)
+		}
+		if rawKey, ok := ConfigGet("ai-commit.fallbackApiKey"); ok && !ov.Offline {
+			key, err := resolveAPIKey(strings.TrimSpace(rawKey), resolved, time.Duration(cfg.TimeoutSeconds)*time.Second, credentialTimeout)
+			if err != nil {
+				return cfg, fmt.Errorf("ai-commit.fallbackApiKey: %w", err)
+			}
+			cfg.FallbackAPIKey = key
+		}
+	}
+
+	if v, ok := ConfigGet("ai-commit.maxTokens"); ok {
+		if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && n >= 0 {
+			cfg.MaxTokens = n
+		}
+	}
+	if v, ok := ConfigGet("ai-commit.seed"); ok {
+		if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil {
+			cfg.Seed = &n
+		}
+	}
+	// Stop sequences: multi-valued, one sequence per value, taken literally.
+	for _, v := range configGetAll("ai-commit.stop") {
+		if v != "" {
+			cfg.Stop = append(cfg.Stop, v)
+		}
+	}
+	if v, ok := ConfigBool("ai-commit.skipWhitespaceOnly"); ok {
+		cfg.SkipWhitespaceOnly = v
+	}
+	if v, ok := ConfigBool("ai-commit.includeStat"); ok {
+		cfg.IncludeStat = v
+	}
+	if v, ok := ConfigBool("ai-commit.textOnly"); ok {
+		cfg.TextOnly = v
+	}
+	if v, ok := ConfigBool("ai-commit.chunked"); ok {
+		cfg.Chunked = v
+	}
+	if v, ok := ConfigGet("ai-commit.chunkBytes"); ok {
+		if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && n > 0 {
+			cfg.ChunkBytes = n
+		}
+	}
+	if v, ok := ConfigGet("ai-commit.connectTimeoutSeconds"); ok {
+		if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && n > 0 {
+			cfg.ConnectTimeoutSeconds = n
+		}
+	}
+
+	if v, ok := ConfigGet("ai-commit.messagesField"); ok && strings.TrimSpace(v) != "" {
+		cfg.MessagesField = strings.TrimSpace(v)
+		if !requestFieldName.MatchString(cfg.MessagesField) {
+			return cfg, fmt.Errorf("invalid ai-commit.messagesField %q: must be a plain identifier such as input", cfg.MessagesField)
+		}
+	}
+	if v, ok := ConfigGet("ai-commit.extraParams"); ok && strings.TrimSpace(v) != "" {
+		params, err := parseExtraParams(v, cfg.MessagesField)
+		if err != nil {
+			return cfg, fmt.Errorf("ai-commit.extraParams: %w", err)
+		}
+		cfg.ExtraParams = params
+	}
+	if v, ok := ConfigGet("ai-commit.systemRole"); ok && strings.TrimSpace(v) != "" {
+		cfg.SystemRole = strings.ToLower(strings.TrimSpace(v))
+		if cfg.SystemRole != "system" && cfg.SystemRole != "developer" {
+			return cfg, fmt.Errorf("unknown ai-commit.systemRole %q (expected system or developer)", v)
+		}
+	}
+	if v, ok := ConfigBool("ai-commit.includeUntracked"); ok {
+		cfg.IncludeUntracked = v
+	}
+	if v, ok := ConfigBool("ai-commit.redactSecrets"); ok {
+		cfg.RedactSecrets = v
+	}
+	if v, ok := ConfigBool("ai-commit.cache"); ok {
+		cfg.Cache = v
+	}
+	if v, ok := ConfigGet("ai-commit.cacheTTLSeconds"); ok {
+		if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && n > 0 {
+			cfg.CacheTTLSeconds = n
+		}
+	}
+	if v, ok := ConfigGet("ai-commit.fallback"); ok && strings.TrimSpace(v) != "" {
+		cfg.Fallback = strings.ToLower(strings.TrimSpace(v))
+		if cfg.Fallback != "none" && cfg.Fallback != "filelist" {
+			return cfg, fmt.Errorf("unknown ai-commit.fallback %q (expected none or filelist)", cfg.Fallback)
+		}
+	}
+	if v, ok := ConfigGet("ai-commit.subjectMaxLength"); ok {
+		if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && n > 0 {
+			cfg.SubjectMaxLen = n
+		}
+	}
+	if v, ok := ConfigGet("ai-commit.style"); ok && strings.TrimSpace(v) != "" {
+		cfg.Style = strings.ToLower(strings.TrimSpace(v))
+		if cfg.Style != "conventional" && cfg.Style != "plain" {
+			return cfg, fmt.Errorf("unknown ai-commit.style %q (expected conventional or plain)", cfg.Style)
+		}
+	}
+	if v, ok := ConfigBool("ai-commit.includeBody"); ok {
+		cfg.IncludeBody = v
+	}
+	if v, ok := ConfigBool("ai-commit.wrapBody"); ok {
+		cfg.WrapBody = v
+	}
+	if v, ok := ConfigGet("ai-commit.wrapWidth"); ok {
+		if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && n > 0 {
+			cfg.WrapWidth = n
+		}
+	}
+	if v, ok := ConfigGet("ai-commit.baseBranch"); ok && strings.TrimSpace(v) != "" {
+		cfg.BaseBranch = strings.TrimSpace(v)
+	}
+	if v, ok := ConfigBool("ai-commit.prIncludeStat"); ok {
+		cfg.PRIncludeStat = v
+	}
+	if v, ok := ConfigBool("ai-commit.structured"); ok {
+		cfg.Structured = v
+	}
+	if v, ok := ConfigBool("ai-commit.retryOnEmpty"); ok {
+		cfg.RetryOnEmpty = v
+	}
+	if v, ok := ConfigBool("ai-commit.subjectOnly"); ok && v {
+		cfg.IncludeBody = false
+	}
+	if v, ok := ConfigGet("ai-commit.bodyThresholdLines"); ok {
+		if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && n >= 0 {
+			cfg.BodyThresholdLines = n
+		}
+	}
+	switch ov.Body {
+	case "subject":
+		cfg.IncludeBody = false
+	case "full":
+		cfg.IncludeBody = true
+		cfg.BodyThresholdLines = 0
+	}
+	if v, ok := ConfigBool("ai-commit.gitmoji"); ok {
+		cfg.Gitmoji = v
+	}
+	if v, ok := ConfigGet("ai-commit.extraTypes"); ok {
+		cfg.ExtraTypes = SplitList(v)
+	}
+	if v, ok := ConfigBool("ai-commit.enforceType"); ok {
+		cfg.EnforceType = v
+	}
+	if v, ok := ConfigBool("ai-commit.fixImperative"); ok {
+		cfg.FixImperative = v
+	}
+	if v, ok := ConfigGet("ai-commit.scopes"); ok {
+		cfg.Scopes = SplitList(v)
+	}
+	if v, ok := ConfigGet("ai-commit.historyCount"); ok {
+		if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && n > 0 {
+			cfg.HistoryCount = n
+		}
+	}
+	if v, ok := ConfigGet("ai-commit.language"); ok {
+		cfg.Language = strings.TrimSpace(v)
+	}
+	if v, ok := ConfigGet("ai-commit.systemPrompt"); ok && strings.TrimSpace(v) != "" {
+		cfg.SystemPrompt = strings.TrimSpace(v)
+	}
+	if v, ok := ConfigGet("ai-commit.coAuthors"); ok {
+		for _, author := range strings.Split(v, ";") {
+			if author = strings.TrimSpace(author); author != "" {
+				cfg.CoAuthors = append(cfg.CoAuthors, author)
+			}
+		}
+	}
+	if v, ok := ConfigGet("ai-commit.proxy"); ok {
+		cfg.Proxy = strings.TrimSpace(v)
+		if cfg.Proxy != "" && !strings.EqualFold(cfg.Proxy, "none") {
+			if _, err := parseProxyURL(cfg.Proxy); err != nil {
+				return cfg, fmt.Errorf("invalid ai-commit.proxy %q: %w", cfg.Proxy, err)
+			}
+		}
+	}
+
+	if v, ok := ConfigGet("ai-commit.caBundle"); ok {
+		cfg.CABundle = strings.TrimSpace(v)
+	}
+	if v, ok := ConfigBool("ai-commit.insecureSkipVerify"); ok {
+		cfg.InsecureTLS = v
+	}
+	if cfg.InsecureTLS {
+		fmt.Fprintln(os.Stderr, "git-ai-commit: WARNING: ai-commit.insecureSkipVerify is enabled — TLS certificates are NOT verified; your diff and API key can be intercepted.")
+	}
+
+	if v, ok := ConfigGet("ai-commit.allowedHosts"); ok {
+		cfg.AllowedHosts = SplitList(v)
+	}
+	if v, ok := ConfigBool("ai-commit.confirmRemote"); ok {
+		cfg.ConfirmRemote = v
+	}
+	if v, ok := ConfigBool("ai-commit.markerTrailer"); ok {
+		cfg.MarkerTrailer = v
+	}
+	if v, ok := ConfigBool("ai-commit.stripMarker"); ok {
+		cfg.StripMarker = v
+	}
+
+	if v, ok := ConfigBool("ai-commit.stripDisclaimers"); ok {
+		cfg.StripDisclaimers = v
+	}
+	if cfg.StripDisclaimers {
+		patterns, err := compileDisclaimerPatterns(configGetAll("ai-commit.disclaimerPattern"))
+		if err != nil {
+			return cfg, fmt.Errorf("ai-commit.disclaimerPattern: %w", err)
+		}
+		cfg.DisclaimerPatterns = patterns
+	}
+
+	// Banned phrases: multi-valued, and each value may hold a comma-separated list.
+	for _, v := range configGetAll("ai-commit.bannedPhrases") {
+		cfg.BannedPhrases = append(cfg.BannedPhrases, SplitList(v)...)
+	}
+
+	if v, ok := ConfigGet("ai-commit.usageLog"); ok && strings.TrimSpace(v) != "" {
+		cfg.UsageLog = ExpandHome(strings.TrimSpace(v))
+		if !filepath.IsAbs(cfg.UsageLog) {
+			if root, err := getRepoRoot(); err == nil {
+				cfg.UsageLog = filepath.Join(root, cfg.UsageLog)
+			}
+		}
+	}
+	for key, dst := range map[string]*float64{
+		"ai-commit.priceInputPer1k":  &cfg.PriceInputPer1k,
+		"ai-commit.priceOutputPer1k": &cfg.PriceOutputPer1k,
+	} {
+		if v, ok := ConfigGet(key); ok {
+			f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil || f < 0 {
+				return cfg, fmt.Errorf("invalid %s %q: expected a non-negative number", key, v)
+			}
+			*dst = f
+		}
+	}
+	if v, ok := ConfigGet("ai-commit.organization"); ok {
+		cfg.Organization = strings.TrimSpace(v)
+	}
+	if v, ok := ConfigGet("ai-commit.project"); ok {
+		cfg.Project = strings.TrimSpace(v)
+	}
+
+	// Extra headers: every ai-commit.header.<Name> entry becomes a request
+	// header. A key may be set several times; each value is sent.
+	for _, kv := range gitConfigGetRegexp(`^ai-commit\.header\.`) {
+		name := strings.TrimPrefix(kv[0], "ai-commit.header.")
+		if name == "" {
+			continue
+		}
+		if cfg.Headers == nil {
+			cfg.Headers = http.Header{}
+		}
+		cfg.Headers.Add(name, strings.TrimSpace(kv[1]))
+	}
+
+	return cfg, nil
+}
+
+// resolveAPIKey resolves the raw value of ai-commit.apiKey into an actual key
+// string. Five forms are supported:
+//
+//  1. Literal — any value that does not match the forms below is returned as-is.
+//  2. Env-var — a value starting with "$" is treated as an environment-variable
+//     name; the variable is read at runtime.
+//     Example config value: $OPENAI_API_KEY
+//  3. git-credentials — the exact string "git-credentials" (case-insensitive)
+//     causes the git credential helper to be queried using the protocol and
+//     host extracted from endpoint; the returned password is used as the key.
+//     The helper must answer within credentialTimeout.
+//  4. File — a value starting with "file:" names a file whose contents are the
+//     key, with trailing newlines removed. This suits Docker and Kubernetes
+//     secrets mounted as files.
+//     Example config value: file:/run/secrets/openai_key
+//  5. Command — a value starting with "exec:" is run through sh, and its
+//     trimmed stdout is the key. The command must finish within timeout.
+//     Example config value: exec:op read op://vault/openai/key
+func resolveAPIKey(raw, endpoint string, timeout, credentialTimeout time.Duration) (string, error) {
+	if raw == "" {
+		return "", nil
+	}
+
+	// Form 2: environment variable reference.
+	if strings.HasPrefix(raw, "$") {
+		varName := raw[1:]
+		if varName == "" {
+			return "", errors.New("environment variable name must not be empty (got bare \"$\")")
+		}
+		val := os.Getenv(varName)
+		if val == "" {
+			return "", fmt.Errorf("environment variable %q is not set or is empty", varName)
+		}
+		return val, nil
+	}
+
+	// Form 3: git credential helper.
+	if strings.EqualFold(raw, "git-credentials") {
+		return resolveAPIKeyFromGitCredentials(endpoint, credentialTimeout)
+	}
+
+	// Form 4: file containing the key.
+	if strings.HasPrefix(raw, "file:") {
+		return resolveAPIKeyFromFile(strings.TrimPrefix(raw, "file:"))
+	}
+
+	// Form 5: command that prints the key.
+	if strings.HasPrefix(raw, "exec:") {
+		return resolveAPIKeyFromCommand(strings.TrimPrefix(raw, "exec:"), timeout)
+	}
+
+	// Form 1: literal value.
+	return raw, nil
+}
+
+// apiKeySource describes where resolveAPIKey takes the key from for a raw
+// ai-commit.apiKey value, for diagnostic output.
+func apiKeySource(raw string) string {
+	switch {
+	case raw == "":
+		return "unset"
+	case strings.HasPrefix(raw, "$"):
+		return "environment variable " + raw
+	case strings.EqualFold(raw, "git-credentials"):
+		return "git credential helper"
+	case strings.HasPrefix(raw, "file:"):
+		return "file " + strings.TrimPrefix(raw, "file:")
+	case strings.HasPrefix(raw, "exec:"):
+		return "command " + strings.TrimSpace(strings.TrimPrefix(raw, "exec:"))
+	default:
+		return "literal value in git config"
+	}
+}
+
+// resolveAPIKeyFromFile reads the API key from path. Trailing newlines are
+// removed so a secret written with a final newline still works; a missing or
+// empty file is an error rather than an empty key.
+func resolveAPIKeyFromFile(path string) (string, error) {
+	if path == "" {
+		return "", errors.New("file path must not be empty (got bare \"file:\")")
+	}
+	path = ExpandHome(path)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("read API key file: %w", err)
+	}
+	key := strings.TrimRight(string(data), "\r\n")
+	if strings.TrimSpace(key) == "" {
+		return "", fmt.Errorf("API key file %s is empty", path)
+	}
+	return key, nil
+}
+
+// resolveAPIKeyFromCommand runs command with sh -c and returns its trimmed
+// stdout as the API key. The command comes straight from git config, so it
+// runs with the user's privileges just like an alias or hook would. On failure
+// the command's stderr is included in the error; stdout never is, since it may
+// hold part of the key.
+func resolveAPIKeyFromCommand(command string, timeout time.Duration) (string, error) {
+	command = strings.TrimSpace(command)
+	if command == "" {
+		return "", errors.New("command must not be empty (got bare \"exec:\")")
+	}
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	// Don't wait on grandchildren that keep stdout open after sh is killed.
+	cmd.WaitDelay = time.Second
+	var out bytes.Buffer
+	var errBuf bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &errBuf
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", fmt.Errorf("API key command timed out after %s", timeout)
+		}
+		stderr := strings.TrimSpace(errBuf.String())
+		if stderr != "" {
+			return "", fmt.Errorf("API key command failed: %w: %s", err, stderr)
+		}
+		return "", fmt.Errorf("API key command failed: %w", err)
+	}
+
+	key := strings.TrimSpace(out.String())
+	if key == "" {
+		return "", errors.New("API key command printed nothing")
+	}
+	return key, nil
+}
+
+// defaultCredentialTimeout bounds `git credential fill` unless
+// ai-commit.credentialTimeoutSeconds says otherwise. Helpers normally answer
+// at once; a keychain prompt waiting for the user is the slow case.
+const defaultCredentialTimeout = 10 * time.Second
+
+// credentialCache holds passwords already returned by the git credential helper
+// in this process, keyed by protocol and host (with port), so that resolving
+// several configurations never triggers a second keychain prompt.
+var credentialCache = struct {
+	sync.Mutex
+	keys map[string]string
+}{keys: map[string]string{}}
+
+// resolveAPIKeyFromGitCredentials asks the configured git credential helper for
+// the password associated with the host of endpoint, then returns it as the API
+// key. It shells out to `git credential fill`, which consults the same helpers
+// that Git itself uses (macOS Keychain, Windows Credential Manager, libsecret,
+// pass, etc.).
+//
+// The "username" field in the credential request is set to "api-key" as a
+// conventional label; most helpers store credentials by (protocol, host,
+// username) so this keeps LLM keys separate from any Git hosting credentials
+// that may share the same hostname.
+//
+// Successful lookups are memoized in credentialCache for the rest of the run.
+// A helper that has not answered within timeout (if positive) is killed.
+func resolveAPIKeyFromGitCredentials(endpoint string, timeout time.Duration) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("cannot parse endpoint URL for git-credentials lookup: %w", err)
+	}
+
+	protocol := u.Scheme
+	host := u.Hostname()
+	port := u.Port()
+
+	if protocol == "" || host == "" {
+		return "", fmt.Errorf("endpoint %q has no scheme or host; cannot query git credential helper", endpoint)
+	}
+
+	cacheKey := protocol + "://" + u.Host
+	credentialCache.Lock()
+	defer credentialCache.Unlock()
+	if key, ok := credentialCache.keys[cacheKey]; ok {
+		return key, nil
+	}
+
+	// Build the input for `git credential fill`.
+	// Format: key=value pairs, one per line, terminated by a blank line.
+	// The credential protocol has no separate port attribute: a non-default
+	// port is part of host, exactly as git itself sends it.
+	if port != "" {
+		host = net.JoinHostPort(host, port)
+	}
+	var input strings.Builder
+	fmt.Fprintf(&input, "protocol=%s\n", protocol)
+	fmt.Fprintf(&input, "host=%s\n", host)
+	fmt.Fprintf(&input, "username=api-key\n")
+	fmt.Fprintf(&input, "\n")
+
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	cmd := gitCommandContext(ctx, "credential", "fill")
+	// The helper runs as a child of git; don't wait on it once git is killed.
+	cmd.WaitDelay = time.Second
+	cmd.Stdin = strings.NewReader(input.String())
+	var out bytes.Buffer
+	var errBuf bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &errBuf
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", fmt.Errorf("git credential fill timed out after %s; check the credential helper, or raise ai-commit.credentialTimeoutSeconds", timeout)
+		}
+		stderr := strings.TrimSpace(errBuf.String())
+		if stderr != "" {
+			return "", fmt.Errorf("git credential fill failed: %w: %s", err, stderr)
+		}
+		return "", fmt.Errorf("git credential fill failed: %w", err)
+	}
+
+	// Parse the output: lines of "key=value".
+	password := ""
+	for _, line := range strings.Split(out.String(), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "password=") {
+			password = strings.TrimPrefix(line, "password=")
+			break
+		}
+	}
+
+	if password == "" {
+		return "", fmt.Errorf(
+			"git credential fill returned no password for protocol=%s host=%s username=api-key\n"+
+				"Store the key with: git credential approve  (or use your system keychain tool)",
+			protocol, host,
+		)
+	}
+
+	credentialCache.keys[cacheKey] = password
+	return password, nil
+}
+
+// SplitList splits a comma-separated config value, trimming whitespace and
+// dropping empty entries.
+func SplitList(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// ExpandHome replaces a leading "~/" in path with the user's home directory.
+func ExpandHome(path string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return path
+}
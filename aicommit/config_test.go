@@ -0,0 +1,444 @@
+package aicommit
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResolveAPIKeyExec(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    string
+		wantErr string
+	}{
+		{"prints key", "exec:echo sk-test", "sk-test", ""},
+		{"trims output", "exec: printf '  sk-test \\n\\n'", "sk-test", ""},
+		{"non-zero exit", "exec:echo oops >&2; exit 3", "", "API key command failed: exit status 3: oops"},
+		{"empty output", "exec:true", "", "API key command printed nothing"},
+		{"whitespace output", "exec:printf ' \\n'", "", "API key command printed nothing"},
+		{"no command", "exec:  ", "", "command must not be empty"},
+		{"timeout", "exec:sleep 5", "", "API key command timed out after 200ms"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveAPIKey(tt.raw, "", 200*time.Millisecond, 0)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("resolveAPIKey(%q) error = %v, want %q", tt.raw, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveAPIKey(%q): %v", tt.raw, err)
+			}
+			if got != tt.want {
+				t.Errorf("resolveAPIKey(%q) = %q, want %q", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveAPIKeyExecKeepsStdoutOutOfErrors(t *testing.T) {
+	_, err := resolveAPIKey("exec:echo sk-secret; exit 1", "", time.Second, 0)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if strings.Contains(err.Error(), "sk-secret") {
+		t.Errorf("error leaks stdout: %v", err)
+	}
+}
+
+func TestResolveAPIKeyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(path, []byte("sk-from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	got, err := resolveAPIKey("file:"+path, "", time.Second, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "sk-from-file" {
+		t.Errorf("resolveAPIKey(file:) = %q, want %q", got, "sk-from-file")
+	}
+}
+
+// useCredentialHelper points git at a credential helper script with the
+// given body, isolated from the user's git config, and empties
+// credentialCache for the duration of the test.
+func useCredentialHelper(t *testing.T, body string) {
+	t.Helper()
+	dir := t.TempDir()
+	helper := filepath.Join(dir, "helper.sh")
+	script := "#!/bin/sh\n[ \"$1\" = get ] || exit 0\n" + body + "\n"
+	if err := os.WriteFile(helper, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(dir)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	t.Setenv("GIT_TERMINAL_PROMPT", "0")
+	t.Setenv("GIT_CONFIG_COUNT", "1")
+	t.Setenv("GIT_CONFIG_KEY_0", "credential.helper")
+	t.Setenv("GIT_CONFIG_VALUE_0", helper)
+
+	credentialCache.Lock()
+	saved := credentialCache.keys
+	credentialCache.keys = map[string]string{}
+	credentialCache.Unlock()
+	t.Cleanup(func() {
+		credentialCache.Lock()
+		credentialCache.keys = saved
+		credentialCache.Unlock()
+	})
+}
+
+func TestGitCredentialsTimeout(t *testing.T) {
+	useCredentialHelper(t, "exec sleep 10")
+
+	start := time.Now()
+	_, err := resolveAPIKeyFromGitCredentials("https://llm.example.com/v1", 300*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "git credential fill timed out after 300ms") {
+		t.Fatalf("error = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("lookup took %s; the helper was not killed", elapsed)
+	}
+}
+
+func TestGitCredentialsCachedAfterFirstLookup(t *testing.T) {
+	useCredentialHelper(t, "echo password=sk-cached")
+	const endpoint = "https://llm.example.com/v1"
+	key, err := resolveAPIKeyFromGitCredentials(endpoint, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "sk-cached" {
+		t.Fatalf("key = %q, want %q", key, "sk-cached")
+	}
+
+	// The helper now hangs; a second lookup must not run it again.
+	t.Setenv("GIT_CONFIG_VALUE_0", "!sleep 10")
+	start := time.Now()
+	key, err = resolveAPIKeyFromGitCredentials(endpoint, 300*time.Millisecond)
+	if err != nil {
+		t.Fatalf("second lookup: %v", err)
+	}
+	if key != "sk-cached" {
+		t.Errorf("second key = %q, want %q", key, "sk-cached")
+	}
+	if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+		t.Errorf("second lookup took %s; it was not served from the cache", elapsed)
+	}
+}
+
+func TestResolveAPIKeyFromFile(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	tests := []struct {
+		name    string
+		raw     string
+		want    string
+		wantErr string
+	}{
+		{"plain", "file:" + write("plain", "sk-plain"), "sk-plain", ""},
+		{"trailing newlines", "file:" + write("lf", "sk-lf\n\n"), "sk-lf", ""},
+		{"trailing crlf", "file:" + write("crlf", "sk-crlf\r\n"), "sk-crlf", ""},
+		{"home directory", "file:~/" + filepath.Base(write("home", "sk-home\n")), "sk-home", ""},
+		{"empty file", "file:" + write("empty", ""), "", "is empty"},
+		{"newline only", "file:" + write("blank", "\n"), "", "is empty"},
+		{"missing file", "file:" + filepath.Join(dir, "missing"), "", "read API key file:"},
+		{"no path", "file:", "", "file path must not be empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveAPIKey(tt.raw, "", time.Second, 0)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("resolveAPIKey(%q) error = %v, want %q", tt.raw, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("resolveAPIKey(%q) = %q, want %q", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPIKeySource(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{"", "unset"},
+		{"sk-literal", "literal value in git config"},
+		{"$OPENAI_API_KEY", "environment variable $OPENAI_API_KEY"},
+		{"git-credentials", "git credential helper"},
+		{"file:/run/secrets/openai_key", "file /run/secrets/openai_key"},
+		{"exec: pass show openai", "command pass show openai"},
+	}
+	for _, tt := range tests {
+		if got := apiKeySource(tt.raw); got != tt.want {
+			t.Errorf("apiKeySource(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestResolveAPIKeyLiteralAndEnv(t *testing.T) {
+	t.Setenv("TEST_AI_COMMIT_KEY", "sk-from-env")
+	t.Setenv("TEST_AI_COMMIT_EMPTY", "")
+	tests := []struct {
+		raw     string
+		want    string
+		wantErr string
+	}{
+		{"", "", ""},
+		{"sk-literal", "sk-literal", ""},
+		{"$TEST_AI_COMMIT_KEY", "sk-from-env", ""},
+		{"$TEST_AI_COMMIT_EMPTY", "", `environment variable "TEST_AI_COMMIT_EMPTY" is not set or is empty`},
+		{"$", "", "environment variable name must not be empty"},
+	}
+	for _, tt := range tests {
+		got, err := resolveAPIKey(tt.raw, "", time.Second, 0)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("resolveAPIKey(%q) error = %v, want %q", tt.raw, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("resolveAPIKey(%q) = %q, %v; want %q", tt.raw, got, err, tt.want)
+		}
+	}
+}
+
+func TestGitCredentialsHelperRunsOncePerHost(t *testing.T) {
+	useCredentialHelper(t, `while read -r line; do case $line in host=*) host=${line#host=};; esac; done
+echo "$host" >> calls
+echo "password=sk-$host"`)
+	calls := func() []string {
+		data, _ := os.ReadFile("calls")
+		return strings.Fields(string(data))
+	}
+
+	for i := 0; i < 3; i++ {
+		key, err := resolveAPIKeyFromGitCredentials("https://llm.example.com/v1", time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if key != "sk-llm.example.com" {
+			t.Fatalf("key = %q", key)
+		}
+	}
+	if got := calls(); len(got) != 1 {
+		t.Fatalf("helper ran %d times for one host, want once: %q", len(got), got)
+	}
+
+	// Another path on the same host shares the entry; another host does not.
+	if _, err := resolveAPIKeyFromGitCredentials("https://llm.example.com/other/v1", time.Second); err != nil {
+		t.Fatal(err)
+	}
+	key, err := resolveAPIKeyFromGitCredentials("https://other.example.com/v1", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "sk-other.example.com" {
+		t.Errorf("key for the second host = %q", key)
+	}
+	if got := calls(); len(got) != 2 {
+		t.Errorf("helper calls = %q, want one per host", got)
+	}
+}
+
+func TestGitCredentialsFailureNotCached(t *testing.T) {
+	useCredentialHelper(t, `[ -f ready ] && echo password=sk-later`)
+
+	if _, err := resolveAPIKeyFromGitCredentials("https://llm.example.com/v1", time.Second); err == nil {
+		t.Fatal("expected an error when the helper has no password")
+	}
+	if err := os.WriteFile("ready", nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	key, err := resolveAPIKeyFromGitCredentials("https://llm.example.com/v1", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "sk-later" {
+		t.Errorf("key = %q, want sk-later", key)
+	}
+}
+
+func TestGitCredentialsInput(t *testing.T) {
+	// Newer versions of git also announce capability[] lines; leave them out.
+	useCredentialHelper(t, `grep -v '^capability' > input
+echo password=sk-test`)
+	tests := []struct {
+		endpoint string
+		want     string
+	}{
+		{"https://llm.example.com/v1", "protocol=https\nhost=llm.example.com\nusername=api-key\n"},
+		{"https://llm.example.com:8443/v1", "protocol=https\nhost=llm.example.com:8443\nusername=api-key\n"},
+		{"http://localhost:11434/v1", "protocol=http\nhost=localhost:11434\nusername=api-key\n"},
+		{"http://[::1]:8080/v1", "protocol=http\nhost=[::1]:8080\nusername=api-key\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.endpoint, func(t *testing.T) {
+			if _, err := resolveAPIKeyFromGitCredentials(tt.endpoint, time.Second); err != nil {
+				t.Fatal(err)
+			}
+			got, err := os.ReadFile("input")
+			if err != nil {
+				t.Fatal(err)
+			}
+			// git hands the helper what it was given, without the blank
+			// line that ends the request.
+			if string(got) != tt.want {
+				t.Errorf("helper input = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadConfigStop(t *testing.T) {
+	newTestRepo(t)
+	runGit(t, "config", "--add", "ai-commit.stop", "```")
+	runGit(t, "config", "--add", "ai-commit.stop", "END")
+
+	cfg, err := ReadConfig(Overrides{Offline: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(cfg.Stop, "|"); got != "```|END" {
+		t.Errorf("Stop = %q, want both values in order", cfg.Stop)
+	}
+}
+
+func TestReadConfigMultiValuedLayers(t *testing.T) {
+	tests := []struct {
+		name        string
+		profile     bool
+		env         string
+		wantBanned  string
+		wantPattern bool
+	}{
+		{name: "git config", wantBanned: "various changes|misc updates|minor tweaks"},
+		{name: "profile replaces", profile: true, wantBanned: "cleanup", wantPattern: true},
+		{name: "env overrides profile", profile: true, env: "stuff, things", wantBanned: "stuff|things", wantPattern: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestRepo(t)
+			t.Setenv("AI_COMMIT_BANNED_PHRASES", tt.env)
+			t.Setenv("AI_COMMIT_PROFILE", "")
+			runGit(t, "config", "--add", "ai-commit.bannedPhrases", "various changes, misc updates")
+			runGit(t, "config", "--add", "ai-commit.bannedPhrases", "minor tweaks")
+			if tt.profile {
+				runGit(t, "config", "ai-commit.profile", "strict")
+				runGit(t, "config", "ai-commit.profiles.strict.bannedPhrases", "cleanup")
+				runGit(t, "config", "ai-commit.profiles.strict.disclaimerPattern", "^generated by")
+			}
+
+			cfg, err := ReadConfig(Overrides{Offline: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Join(cfg.BannedPhrases, "|"); got != tt.wantBanned {
+				t.Errorf("BannedPhrases = %q, want %q", got, tt.wantBanned)
+			}
+			stripped := StripTrailingDisclaimers("fix: typo\n\nGenerated by a local model.\n", cfg.DisclaimerPatterns)
+			if got := stripped == "fix: typo\n"; got != tt.wantPattern {
+				t.Errorf("profile disclaimer pattern applied = %v, want %v", got, tt.wantPattern)
+			}
+		})
+	}
+}
+
+func TestReadConfigSystemRole(t *testing.T) {
+	newTestRepo(t)
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"", "system", false},
+		{"developer", "developer", false},
+		{" Developer ", "developer", false},
+		{"assistant", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if tt.value != "" {
+				runGit(t, "config", "ai-commit.systemRole", tt.value)
+				defer runGit(t, "config", "--unset", "ai-commit.systemRole")
+			}
+			cfg, err := ReadConfig(Overrides{Offline: true})
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "unknown ai-commit.systemRole") {
+					t.Errorf("error = %v, want an unknown role error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.SystemRole != tt.want {
+				t.Errorf("SystemRole = %q, want %q", cfg.SystemRole, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigBoolPrecedence(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     string
+		profile string
+		local   string
+		global  string
+		want    bool
+		ok      bool
+	}{
+		{name: "unset", ok: false},
+		{name: "global", global: "false", want: false, ok: true},
+		{name: "local over global", local: "true", global: "false", want: true, ok: true},
+		{name: "profile over local", profile: "off", local: "true", want: false, ok: true},
+		{name: "env over profile", env: "yes", profile: "false", want: true, ok: true},
+		{name: "invalid env ignored", env: "maybe", global: "false", want: false, ok: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := newTestRepo(t)
+			t.Setenv("GIT_CONFIG_GLOBAL", filepath.Join(dir, "global.gitconfig"))
+			t.Setenv("AI_COMMIT_FAIL_OPEN", tt.env)
+			if tt.global != "" {
+				runGit(t, "config", "--global", "ai-commit.failOpen", tt.global)
+			}
+			if tt.local != "" {
+				runGit(t, "config", "ai-commit.failOpen", tt.local)
+			}
+			if tt.profile != "" {
+				runGit(t, "config", "ai-commit.profiles.ci.failOpen", tt.profile)
+				activeProfile = "ci"
+			}
+
+			got, ok := ConfigBool("ai-commit.failOpen")
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("ConfigBool = %v, %v; want %v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
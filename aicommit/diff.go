@@ -0,0 +1,694 @@
+package aicommit
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// RangeSummary returns the commit log (subjects and bodies, oldest first)
+// and diff stat of from..to, or "" when the range has no commits.
+func RangeSummary(from, to string) (string, error) {
+	log, err := GitOutput("log", "--no-merges", "--reverse", "--pretty=format:- %s%n%w(0,4,4)%b", from+".."+to)
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(log) == "" {
+		return "", nil
+	}
+	var lines []string
+	for _, line := range strings.Split(log, "\n") {
+		line = strings.TrimRight(line, " ")
+		if markerLine.MatchString(strings.TrimSpace(line)) ||
+			(line == "" && len(lines) > 0 && lines[len(lines)-1] == "") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	log = strings.Join(lines, "\n")
+	stat, err := GitOutput("diff", "--stat", "--no-color", from+".."+to)
+	if err != nil {
+		return "", err
+	}
+	return "Commits (oldest first):\n" + strings.TrimRight(log, "\n") + "\n\nDiff stat:\n" + stat, nil
+}
+
+// StagedWhitespaceOnly reports whether there are staged changes against base
+// (HEAD when empty) and all of them only touch whitespace or blank lines,
+// going by git diff --ignore-all-space --ignore-blank-lines. Mode changes,
+// new empty files and the like count as real changes. It looks at the whole
+// index, including paths kept out of the prompt, since those are committed
+// too.
+func StagedWhitespaceOnly(base string) (bool, error) {
+	args := []string{"diff", "--cached", "--no-color", "--no-ext-diff"}
+	if base != "" {
+		args = append(args, base)
+	}
+	names, err := GitOutput(append(args, "--name-only")...)
+	if err != nil || strings.TrimSpace(names) == "" {
+		return false, err
+	}
+	rest, err := GitOutput(append(args, "--ignore-all-space", "--ignore-blank-lines")...)
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(rest) == "", nil
+}
+
+// WhitespaceOnlyMessage is the message used instead of asking the model when
+// ai-commit.skipWhitespaceOnly is on and StagedWhitespaceOnly holds.
+func WhitespaceOnlyMessage(cfg Config) string {
+	if cfg.Style == "plain" {
+		return "Apply formatting changes\n"
+	}
+	return "style: formatting changes\n"
+}
+
+// StagedDiff returns the staged changes as a diff, honouring
+// .aicommitignore, ai-commit.includeUntracked and ai-commit.maxDiffBytes
+// (which chunked mode lifts, see Config.DiffLimit).
+func StagedDiff(cfg Config) (string, error) {
+	return StagedDiffFrom(cfg, "")
+}
+
+// StagedDiffFrom is StagedDiff against base instead of HEAD, e.g. the
+// commit before the one being amended. An empty base means HEAD.
+func StagedDiffFrom(cfg Config, base string) (string, error) {
+	excludes, err := ignorePathspecs()
+	if err != nil {
+		return "", err
+	}
+
+	// Staged diff only, and disable color/ext diff to keep prompts clean and deterministic.
+	args := []string{"diff", "--cached", "--no-color", "--no-ext-diff"}
+	if base != "" {
+		args = append(args, base)
+	}
+	var pathspecs []string
+	if len(excludes) > 0 {
+		warnIgnoredFiles(args, excludes)
+		pathspecs = append([]string{"--", ":/"}, excludes...)
+	}
+	cmd := GitCommand(append(args, pathspecs...)...)
+	var out bytes.Buffer
+	var errBuf bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &errBuf
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git diff --cached failed: %v: %s", err, strings.TrimSpace(errBuf.String()))
+	}
+	diff := out.String()
+	if cfg.TextOnly {
+		diff = omitBinaryFiles(diff)
+	}
+	if cfg.IncludeStat && diff != "" {
+		if diff, err = prependStat(diff, args, pathspecs); err != nil {
+			return "", err
+		}
+	}
+
+	if cfg.IncludeUntracked {
+		untracked, err := getUntrackedDiff(excludes, cfg.TextOnly)
+		if err != nil {
+			return "", err
+		}
+		diff += untracked
+	}
+
+	return TruncateDiff(diff, cfg.DiffLimit()), nil
+}
+
+// RangeDiff returns the diff between two committed revisions, from..to,
+// with the same .aicommitignore and size limit handling as the staged diff.
+func RangeDiff(cfg Config, from, to string) (string, error) {
+	for _, rev := range []string{from, to} {
+		if err := VerifyRevision(rev); err != nil {
+			return "", err
+		}
+	}
+	excludes, err := ignorePathspecs()
+	if err != nil {
+		return "", err
+	}
+
+	args := []string{"diff", "--no-color", "--no-ext-diff", from + ".." + to}
+	var pathspecs []string
+	if len(excludes) > 0 {
+		warnIgnoredFiles(args, excludes)
+		pathspecs = append([]string{"--", ":/"}, excludes...)
+	}
+	cmd := GitCommand(append(args, pathspecs...)...)
+	var out bytes.Buffer
+	var errBuf bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &errBuf
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git diff %s..%s failed: %v: %s", from, to, err, strings.TrimSpace(errBuf.String()))
+	}
+	diff := out.String()
+	if cfg.TextOnly {
+		diff = omitBinaryFiles(diff)
+	}
+	if cfg.IncludeStat && diff != "" {
+		if diff, err = prependStat(diff, args, pathspecs); err != nil {
+			return "", err
+		}
+	}
+	return TruncateDiff(diff, cfg.DiffLimit()), nil
+}
+
+// prependStat puts the --stat summary of the git diff command args (run with
+// the same pathspecs) in front of diff, for ai-commit.includeStat. The
+// summary comes first so the model sees the shape of the change before the
+// details, and so truncation never cuts it off.
+func prependStat(diff string, args, pathspecs []string) (string, error) {
+	statArgs := append(append(append([]string{}, args...), "--stat"), pathspecs...)
+	stat, err := GitOutput(statArgs...)
+	if err != nil {
+		return "", err
+	}
+	return "Diff stat:\n" + strings.TrimRight(stat, "\n") + "\n\n" + diff, nil
+}
+
+// omitBinaryFiles drops the per-file sections of diff that only say
+// "Binary files ... differ", for ai-commit.textOnly, and lists those files
+// by name at the top instead, so the model still knows they changed.
+func omitBinaryFiles(diff string) string {
+	var text, binaries strings.Builder
+	for _, section := range splitDiffFiles(diff) {
+		if !isBinaryDiff(section) {
+			text.WriteString(section)
+			continue
+		}
+		change := "modified"
+		switch {
+		case strings.Contains(section, "\nnew file mode "):
+			change = "added"
+		case strings.Contains(section, "\ndeleted file mode "):
+			change = "deleted"
+		}
+		fmt.Fprintf(&binaries, "  %s (%s)\n", diffFilePath(strings.SplitAfter(section, "\n")), change)
+	}
+	if binaries.Len() == 0 {
+		return diff
+	}
+	return "Binary files changed (contents not shown):\n" + binaries.String() + "\n" + text.String()
+}
+
+// isBinaryDiff reports whether a per-file diff section describes a binary
+// file, either as the "Binary files ... differ" line or as a binary patch.
+func isBinaryDiff(section string) bool {
+	for _, line := range strings.Split(section, "\n") {
+		if strings.HasPrefix(line, "@@") {
+			return false
+		}
+		if strings.HasPrefix(line, "Binary files ") && strings.HasSuffix(line, " differ") || line == "GIT binary patch" {
+			return true
+		}
+	}
+	return false
+}
+
+// ignoreFileName is the gitignore-style file at the repository root listing
+// paths whose content is never sent to the LLM.
+const ignoreFileName = ".aicommitignore"
+
+// ignorePathspecs translates the patterns in .aicommitignore, plus those in
+// ai-commit.excludePaths, into exclude pathspecs for git diff and git
+// ls-files. It supports the common gitignore
+// forms: "name" matches at any depth, a leading or inner "/" anchors the
+// pattern to the repository root, and a trailing "/" matches directories
+// only. Negated patterns ("!") are not supported and are skipped.
+func ignorePathspecs() ([]string, error) {
+	root, err := getRepoRoot()
+	if err != nil {
+		return nil, nil
+	}
+	data, err := os.ReadFile(filepath.Join(root, ignoreFileName))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("read %s: %w", ignoreFileName, err)
+	}
+	patterns := strings.Split(string(data), "\n")
+	if v, ok := ConfigGet("ai-commit.excludePaths"); ok {
+		patterns = append(patterns, SplitList(v)...)
+	}
+
+	var specs []string
+	for _, line := range patterns {
+		p := strings.TrimSpace(line)
+		if p == "" || strings.HasPrefix(p, "#") {
+			continue
+		}
+		if strings.HasPrefix(p, "!") {
+			Debugf("%s: negated pattern %q is not supported; skipping", ignoreFileName, p)
+			continue
+		}
+		dirOnly := strings.HasSuffix(p, "/")
+		p = strings.TrimSuffix(p, "/")
+		anchored := strings.Contains(p, "/")
+		p = strings.TrimPrefix(p, "/")
+		if p == "" {
+			continue
+		}
+		if !anchored {
+			p = "**/" + p
+		}
+		if !dirOnly {
+			specs = append(specs, ":(top,exclude,glob)"+p)
+		}
+		specs = append(specs, ":(top,exclude,glob)"+p+"/**")
+	}
+	return specs, nil
+}
+
+// warnIgnoredFiles tells the user which staged files were withheld by
+// .aicommitignore or ai-commit.excludePaths. diffArgs is the git diff command
+// line without pathspecs.
+func warnIgnoredFiles(diffArgs, excludes []string) {
+	names := func(extra ...string) map[string]bool {
+		args := append(append([]string{}, diffArgs...), "--name-only", "-z")
+		cmd := GitCommand(append(args, extra...)...)
+		var out bytes.Buffer
+		cmd.Stdout = &out
+		cmd.Stderr = io.Discard
+		set := map[string]bool{}
+		if cmd.Run() == nil {
+			for _, f := range strings.Split(out.String(), "\x00") {
+				if f != "" {
+					set[f] = true
+				}
+			}
+		}
+		return set
+	}
+	sent := names(append([]string{"--", ":/"}, excludes...)...)
+	var withheld []string
+	for f := range names() {
+		if !sent[f] {
+			withheld = append(withheld, f)
+		}
+	}
+	if len(withheld) == 0 {
+		return
+	}
+	sort.Strings(withheld)
+	fmt.Fprintf(os.Stderr, "git-ai-commit: warning: %d changed file(s) matched %s or ai-commit.excludePaths and were not sent: %s\n",
+		len(withheld), ignoreFileName, strings.Join(withheld, ", "))
+}
+
+// nameStatusVerbs maps git diff --name-status letters to the verb used in a
+// fallback message's bullets.
+var nameStatusVerbs = map[byte]string{
+	'A': "Add",
+	'C': "Copy",
+	'D': "Delete",
+	'M': "Update",
+	'R': "Rename",
+	'T': "Change type of",
+}
+
+// FileListMessage builds a simple commit message from the staged file list,
+// used by ai-commit.fallback=filelist when the LLM cannot be reached. It
+// returns "" when nothing is staged.
+func FileListMessage(cfg Config) (string, error) {
+	cmd := GitCommand("diff", "--cached", "--name-status", "--no-color")
+	var out bytes.Buffer
+	var errBuf bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &errBuf
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git diff --cached --name-status failed: %v: %s", err, strings.TrimSpace(errBuf.String()))
+	}
+
+	var bullets []string
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) < 2 || fields[0] == "" {
+			continue
+		}
+		verb, ok := nameStatusVerbs[fields[0][0]]
+		if !ok {
+			verb = "Update"
+		}
+		path := fields[1]
+		if len(fields) >= 3 {
+			// Renames and copies list the source and the destination.
+			path = fields[1] + " -> " + fields[2]
+		}
+		bullets = append(bullets, "- "+verb+" "+path)
+	}
+	if len(bullets) == 0 {
+		return "", nil
+	}
+
+	noun := "files"
+	if len(bullets) == 1 {
+		noun = "file"
+	}
+	subject := fmt.Sprintf("chore: update %d %s", len(bullets), noun)
+	if cfg.Style == "plain" {
+		subject = fmt.Sprintf("Update %d %s", len(bullets), noun)
+	}
+	return subject + "\n\n" + strings.Join(bullets, "\n"), nil
+}
+
+// getUntrackedDiff returns a clearly labelled section listing untracked (not
+// ignored) files followed by their content as diffs against /dev/null, for
+// users who stage everything right before committing. It returns "" when
+// there are no untracked files. With textOnly, binary files are only listed.
+func getUntrackedDiff(excludes []string, textOnly bool) (string, error) {
+	args := []string{"ls-files", "--others", "--exclude-standard", "-z"}
+	if len(excludes) > 0 {
+		args = append(append(args, "--", "."), excludes...)
+	}
+	cmd := GitCommand(args...)
+	var out bytes.Buffer
+	var errBuf bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &errBuf
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git ls-files failed: %v: %s", err, strings.TrimSpace(errBuf.String()))
+	}
+	var files []string
+	for _, f := range strings.Split(out.String(), "\x00") {
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+	if len(files) == 0 {
+		return "", nil
+	}
+
+	var b strings.Builder
+	b.WriteString("\n[untracked files: not staged yet, but expected to be part of this commit]\n")
+	for _, f := range files {
+		fmt.Fprintf(&b, "%s\n", f)
+	}
+	b.WriteString("\n")
+	for _, f := range files {
+		// git diff --no-index exits 1 when the files differ, which is
+		// always the case here; only treat other failures as errors.
+		cmd := GitCommand("diff", "--no-index", "--no-color", "--no-ext-diff", "--", os.DevNull, f)
+		var fileOut bytes.Buffer
+		cmd.Stdout = &fileOut
+		cmd.Stderr = io.Discard
+		err := cmd.Run()
+		var exitErr *exec.ExitError
+		if err != nil && !(errors.As(err, &exitErr) && exitErr.ExitCode() == 1) {
+			continue
+		}
+		if textOnly && isBinaryDiff(fileOut.String()) {
+			continue
+		}
+		b.Write(fileOut.Bytes())
+	}
+	return b.String(), nil
+}
+
+// TruncateDiff caps diff at maxBytes (if positive), appending a marker so the
+// model knows the content is incomplete. The marker records how much was cut,
+// which TruncatedBytes reports back to callers.
+func TruncateDiff(diff string, maxBytes int) string {
+	if maxBytes > 0 && len(diff) > maxBytes {
+		return diff[:maxBytes] + fmt.Sprintf("\n\n[diff truncated: %d bytes omitted]\n", len(diff)-maxBytes)
+	}
+	return diff
+}
+
+// truncationMarker matches the marker TruncateDiff appends.
+var truncationMarker = regexp.MustCompile(`\n\n\[diff truncated: ([0-9]+) bytes omitted\]\n$`)
+
+// TruncatedBytes returns how many bytes TruncateDiff cut from diff, or 0 if
+// diff was not truncated.
+func TruncatedBytes(diff string) int {
+	m := truncationMarker.FindStringSubmatch(diff)
+	if m == nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(m[1])
+	return n
+}
+
+// MarkPartialDiff prefixes diff with a note telling the model that it sees a
+// deliberate subset of the changes, so it describes only that subset.
+func MarkPartialDiff(diff string) string {
+	return "[partial selection: this diff contains only some of the changes in the working tree; describe only what is shown]\n\n" + diff
+}
+
+// HunkSpec selects the hunks of files matching Path whose new-side line range
+// overlaps [Start, End]. A zero Start and End select every hunk of the file.
+type HunkSpec struct {
+	Path       string
+	Start, End int
+}
+
+// ReadHunkSpecs parses a selection file with one spec per line:
+//
+//	path/to/file.go           all hunks in the file
+//	path/to/file.go:120-180   hunks overlapping lines 120-180 (new side)
+//	path/to/file.go:42        hunks containing line 42
+//	internal/*                glob or directory prefixes are accepted as paths
+//
+// Blank lines and lines starting with "#" are ignored.
+func ReadHunkSpecs(file string) ([]HunkSpec, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("read hunk selection: %w", err)
+	}
+	var specs []HunkSpec
+	for n, line := range strings.Split(strings.ReplaceAll(string(b), "\r\n", "\n"), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		spec := HunkSpec{Path: line}
+		if p, rng, ok := cutLast(line, ":"); ok && rng != "" && strings.Trim(rng, "0123456789-") == "" {
+			spec.Path = p
+			lo, hi, isRange := strings.Cut(rng, "-")
+			start, err1 := strconv.Atoi(lo)
+			end := start
+			var err2 error
+			if isRange {
+				end, err2 = strconv.Atoi(hi)
+			}
+			if err1 != nil || err2 != nil || start <= 0 || end < start {
+				return nil, fmt.Errorf("%s:%d: invalid line range %q", file, n+1, rng)
+			}
+			spec.Start, spec.End = start, end
+		}
+		specs = append(specs, spec)
+	}
+	if len(specs) == 0 {
+		return nil, fmt.Errorf("%s: no hunk selections found", file)
+	}
+	return specs, nil
+}
+
+// cutLast slices s around the last instance of sep.
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+// hunkHeader matches "@@ -a,b +c,d @@" and captures the new-side start and length.
+var hunkHeader = regexp.MustCompile(`^@@ -[0-9]+(?:,[0-9]+)? \+([0-9]+)(?:,([0-9]+))? @@`)
+
+// FilterDiffHunks keeps only the file sections and hunks of a unified diff
+// selected by specs. File headers are kept for every file with at least one
+// selected hunk; files without hunks (e.g. binary or mode-only changes) are
+// kept when their path is selected without a line range.
+func FilterDiffHunks(diff string, specs []HunkSpec) string {
+	var out strings.Builder
+	for _, section := range splitDiffFiles(diff) {
+		lines := strings.SplitAfter(section, "\n")
+		file := diffFilePath(lines)
+
+		var fileSpecs []HunkSpec
+		for _, sp := range specs {
+			if pathspecMatch(sp.Path, file) {
+				fileSpecs = append(fileSpecs, sp)
+			}
+		}
+		if len(fileSpecs) == 0 {
+			continue
+		}
+
+		var header, body strings.Builder
+		var hunk strings.Builder
+		keep := false
+		inHunks := false
+		flush := func() {
+			if keep {
+				body.WriteString(hunk.String())
+			}
+			hunk.Reset()
+		}
+		for _, line := range lines {
+			if m := hunkHeader.FindStringSubmatch(line); m != nil {
+				flush()
+				inHunks = true
+				start, _ := strconv.Atoi(m[1])
+				length := 1
+				if m[2] != "" {
+					length, _ = strconv.Atoi(m[2])
+				}
+				keep = hunkSelected(fileSpecs, start, start+max(length, 1)-1)
+			}
+			if inHunks {
+				hunk.WriteString(line)
+			} else {
+				header.WriteString(line)
+			}
+		}
+		flush()
+
+		if body.Len() > 0 || (!inHunks && hunkSelected(fileSpecs, 0, 0)) {
+			out.WriteString(header.String())
+			out.WriteString(body.String())
+		}
+	}
+	return out.String()
+}
+
+// hunkSelected reports whether any spec selects the new-side range [start, end].
+func hunkSelected(specs []HunkSpec, start, end int) bool {
+	for _, sp := range specs {
+		if sp.Start == 0 && sp.End == 0 {
+			return true
+		}
+		if start <= sp.End && end >= sp.Start {
+			return true
+		}
+	}
+	return false
+}
+
+// splitDiffFiles splits a unified diff into per-file sections, each starting
+// with its "diff --git" line.
+func splitDiffFiles(diff string) []string {
+	var sections []string
+	start := -1
+	for i := 0; i < len(diff); {
+		if strings.HasPrefix(diff[i:], "diff --git ") {
+			if start >= 0 {
+				sections = append(sections, diff[start:i])
+			}
+			start = i
+		}
+		next := strings.IndexByte(diff[i:], '\n')
+		if next < 0 {
+			break
+		}
+		i += next + 1
+	}
+	if start >= 0 {
+		sections = append(sections, diff[start:])
+	}
+	return sections
+}
+
+// diffFilePath returns the (new-side) path of a per-file diff section.
+func diffFilePath(lines []string) string {
+	for _, line := range lines {
+		line = strings.TrimRight(line, "\n")
+		if strings.HasPrefix(line, "+++ b/") {
+			return strings.TrimPrefix(line, "+++ b/")
+		}
+		if strings.HasPrefix(line, "@@") {
+			break
+		}
+	}
+	// Deleted or binary files have no "+++ b/" line; use the header.
+	if len(lines) > 0 {
+		header := strings.TrimRight(lines[0], "\n")
+		if i := strings.LastIndex(header, " b/"); i >= 0 {
+			return header[i+len(" b/"):]
+		}
+	}
+	return ""
+}
+
+// pathspecMatch reports whether file is selected by spec: an exact path, a
+// directory prefix, or a glob pattern.
+func pathspecMatch(spec, file string) bool {
+	spec = strings.TrimPrefix(spec, "./")
+	if spec == file || strings.HasPrefix(file, strings.TrimSuffix(spec, "/")+"/") {
+		return true
+	}
+	ok, _ := path.Match(spec, file)
+	return ok
+}
+
+// diffEnvVar lets wrapper scripts drive the hook with a diff they have already
+// computed (e.g. with some hunks excluded) instead of the staged diff.
+const diffEnvVar = "GIT_AI_COMMIT_DIFF"
+
+// DiffFromEnv returns the diff supplied via GIT_AI_COMMIT_DIFF. The value may
+// be a path to a file containing the diff, or the diff text itself. ok is
+// false when the variable is unset or empty, in which case callers should use
+// the staged diff.
+func DiffFromEnv(maxBytes int) (diff string, ok bool, err error) {
+	raw := os.Getenv(diffEnvVar)
+	if strings.TrimSpace(raw) == "" {
+		return "", false, nil
+	}
+
+	// A single-line value that names a file is read from disk.
+	if !strings.Contains(raw, "\n") {
+		info, statErr := os.Stat(raw)
+		if statErr == nil && info.Mode().IsRegular() {
+			b, err := os.ReadFile(raw)
+			if err != nil {
+				return "", false, fmt.Errorf("%s: read %s: %w", diffEnvVar, raw, err)
+			}
+			return TruncateDiff(string(b), maxBytes), true, nil
+		}
+		if statErr == nil {
+			return "", false, fmt.Errorf("%s: %s is not a regular file", diffEnvVar, raw)
+		}
+	}
+
+	// Otherwise the value must look like diff text.
+	if !looksLikeDiff(raw) {
+		return "", false, fmt.Errorf("%s is neither a readable file nor diff text", diffEnvVar)
+	}
+	return TruncateDiff(raw, maxBytes), true, nil
+}
+
+// looksLikeDiff reports whether s contains the markers of a unified diff.
+func looksLikeDiff(s string) bool {
+	return strings.Contains(s, "diff --git ") ||
+		((strings.HasPrefix(s, "--- ") || strings.Contains(s, "\n--- ")) && strings.Contains(s, "\n+++ ")) ||
+		strings.Contains(s, "\n@@ ")
+}
+
+// isSmallDiff reports whether diff touches a single file and changes fewer
+// than threshold lines. A threshold of zero or less disables the check.
+func isSmallDiff(diff string, threshold int) bool {
+	if threshold <= 0 {
+		return false
+	}
+	files, changed := 0, 0
+	for _, line := range strings.Split(diff, "\n") {
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			files++
+		case strings.HasPrefix(line, "+++ "), strings.HasPrefix(line, "--- "):
+			// File headers, not content.
+		case strings.HasPrefix(line, "+"), strings.HasPrefix(line, "-"):
+			changed++
+		}
+	}
+	return files == 1 && changed < threshold
+}
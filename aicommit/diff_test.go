@@ -0,0 +1,201 @@
+package aicommit
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestTruncateDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		diff     string
+		maxBytes int
+		want     string
+	}{
+		{"under limit", "abcdef", 10, "abcdef"},
+		{"at limit", "abcdef", 6, "abcdef"},
+		{"over limit", "abcdefghij", 4, "abcd\n\n[diff truncated: 6 bytes omitted]\n"},
+		{"zero means no limit", "abcdef", 0, "abcdef"},
+		{"negative means no limit", "abcdef", -1, "abcdef"},
+		{"empty", "", 4, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TruncateDiff(tt.diff, tt.maxBytes); got != tt.want {
+				t.Errorf("TruncateDiff(%q, %d) = %q, want %q", tt.diff, tt.maxBytes, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStagedDiffTextOnly(t *testing.T) {
+	newTestRepo(t)
+	writeFile(t, "README", "hello\n")
+	writeFile(t, "old.bin", "\x00\x01old")
+	writeFile(t, "icon.bin", "\x00\x01icon")
+	runGit(t, "add", ".")
+	runGit(t, "commit", "-q", "-m", "initial")
+
+	writeFile(t, "README", "hello\nworld\n")
+	writeFile(t, "logo.png", "\x89PNG\x00\x00\x00binary")
+	writeFile(t, "icon.bin", "\x00\x02icon")
+	runGit(t, "rm", "-q", "old.bin")
+	runGit(t, "add", ".")
+
+	diff, err := StagedDiff(Config{TextOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantList := "Binary files changed (contents not shown):\n" +
+		"  icon.bin (modified)\n" +
+		"  logo.png (added)\n" +
+		"  old.bin (deleted)\n\n"
+	if !strings.HasPrefix(diff, wantList) {
+		t.Errorf("diff does not start with the binary file list:\n%s", diff)
+	}
+	for _, name := range []string{"icon.bin", "logo.png", "old.bin"} {
+		if strings.Count(diff, name) != 1 {
+			t.Errorf("%s appears %d times, want only in the list:\n%s", name, strings.Count(diff, name), diff)
+		}
+	}
+	if strings.Contains(diff, "PNG") || strings.Contains(diff, "\x00") {
+		t.Errorf("diff contains binary content:\n%q", diff)
+	}
+	if !strings.Contains(diff, "diff --git a/README b/README") || !strings.Contains(diff, "+world") {
+		t.Errorf("diff lost the text change:\n%s", diff)
+	}
+
+	diff, err = StagedDiff(Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(diff, "Binary files /dev/null and b/logo.png differ") {
+		t.Errorf("with textOnly off, the binary diff should be kept:\n%s", diff)
+	}
+}
+
+func TestStagedDiffTextOnlyUntracked(t *testing.T) {
+	newTestRepo(t)
+	writeFile(t, "README", "hello\n")
+	runGit(t, "add", ".")
+	runGit(t, "commit", "-q", "-m", "initial")
+
+	writeFile(t, "notes.txt", "todo\n")
+	writeFile(t, "data.bin", "\x00\x01\x02")
+
+	diff, err := StagedDiff(Config{TextOnly: true, IncludeUntracked: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(diff, "+todo") {
+		t.Errorf("untracked text file missing:\n%s", diff)
+	}
+	if strings.Contains(diff, "\x00") {
+		t.Errorf("untracked binary content included:\n%q", diff)
+	}
+}
+
+func TestTruncatedBytes(t *testing.T) {
+	tests := []struct {
+		name string
+		diff string
+		want int
+	}{
+		{"not truncated", "diff --git a/x b/x\n+x\n", 0},
+		{"truncated", TruncateDiff(strings.Repeat("x", 100), 40), 60},
+		{"marker not at the end", "[diff truncated: 5 bytes omitted]\n+more\n", 0},
+		{"empty", "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TruncatedBytes(tt.diff); got != tt.want {
+				t.Errorf("TruncatedBytes = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStagedDiffTruncation(t *testing.T) {
+	newTestRepo(t)
+	writeFile(t, "big.txt", strings.Repeat("line of text\n", 200))
+	runGit(t, "add", "big.txt")
+
+	full, err := StagedDiff(Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff, err := StagedDiff(Config{MaxDiffBytes: 500})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := TruncatedBytes(diff), len(full)-500; got != want {
+		t.Errorf("TruncatedBytes = %d, want %d", got, want)
+	}
+	if !strings.HasPrefix(diff, full[:500]) {
+		t.Error("truncated diff does not start with the full diff")
+	}
+
+	// Chunked mode summarizes the whole diff in parts instead.
+	diff, err = StagedDiff(Config{MaxDiffBytes: 500, Chunked: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff != full {
+		t.Errorf("chunked diff was truncated to %d of %d bytes", len(diff), len(full))
+	}
+}
+
+func TestStagedWhitespaceOnly(t *testing.T) {
+	const original = "func main() {\n\tprintln(\"hi\")\n}\n"
+	tests := []struct {
+		name   string
+		change func(t *testing.T)
+		want   bool
+	}{
+		{"nothing staged", func(t *testing.T) {}, false},
+		{"reindented", func(t *testing.T) {
+			writeFile(t, "main.go", "func main() {\n    println(\"hi\")\n}\n")
+		}, true},
+		{"spaces inside a line", func(t *testing.T) {
+			writeFile(t, "main.go", "func main()  {\n\tprintln( \"hi\" )\n}\n")
+		}, true},
+		{"blank lines added", func(t *testing.T) {
+			writeFile(t, "main.go", "func main() {\n\n\tprintln(\"hi\")\n\n}\n")
+		}, true},
+		{"code changed", func(t *testing.T) {
+			writeFile(t, "main.go", "func main() {\n\tprintln(\"hello\")\n}\n")
+		}, false},
+		{"reindent plus a real change", func(t *testing.T) {
+			writeFile(t, "main.go", "func main() {\n  println(\"hi\")\n}\n")
+			writeFile(t, "other.go", "package other\n")
+		}, false},
+		{"new empty file", func(t *testing.T) {
+			writeFile(t, "empty", "")
+		}, false},
+		{"mode change", func(t *testing.T) {
+			if err := os.Chmod("main.go", 0o755); err != nil {
+				t.Fatal(err)
+			}
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestRepo(t)
+			runGit(t, "config", "core.fileMode", "true")
+			writeFile(t, "main.go", original)
+			runGit(t, "add", ".")
+			runGit(t, "commit", "-q", "-m", "initial")
+
+			tt.change(t)
+			runGit(t, "add", "-A")
+			got, err := StagedWhitespaceOnly("")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("StagedWhitespaceOnly = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+// Package aicommit generates Git commit messages with an OpenAI-compatible
+// chat completions API. It is the engine behind the git-ai-commit command
+// and can be used from other Go programs:
+//
+//	cfg, err := aicommit.ReadConfig(aicommit.Overrides{})
+//	if err != nil {
+//		return err
+//	}
+//	diff, err := aicommit.StagedDiff(cfg)
+//	if err != nil {
+//		return err
+//	}
+//	msg, err := aicommit.Generate(ctx, cfg, diff)
+//
+// ReadConfig reads the same ai-commit.* git config keys and AI_COMMIT_*
+// environment variables as the command, from the repository in the current
+// working directory. A Config can also be filled in directly; its Endpoint
+// must then be a full chat completions URL, as returned by
+// ResolveChatCompletionsEndpoint.
+package aicommit
@@ -0,0 +1,177 @@
+package aicommit
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// localHosts are endpoint hosts that never leave the machine (or its
+// containers), so confirmRemote does not ask about them.
+var localHosts = []string{"localhost", "host.docker.internal", "::1"}
+
+// IsLocalEndpoint reports whether the endpoint URL points at this machine.
+func IsLocalEndpoint(endpoint string) bool {
+	host := EndpointHost(endpoint)
+	for _, h := range localHosts {
+		if strings.EqualFold(host, h) {
+			return true
+		}
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return true
+	}
+	return false
+}
+
+// EndpointHost returns the host name of an endpoint URL, without the port.
+// A Unix socket endpoint is reported as localhost.
+func EndpointHost(endpoint string) string {
+	if _, _, ok := SplitUnixEndpoint(endpoint); ok {
+		return "localhost"
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return endpoint
+	}
+	return u.Hostname()
+}
+
+// CheckAllowedHost returns an error unless endpoint's host is on the
+// ai-commit.allowedHosts list. Entries match the host name exactly (ignoring
+// case and port), and "*.example.com" matches any subdomain. An empty list
+// allows every host.
+func CheckAllowedHost(allowed []string, endpoint string) error {
+	if len(allowed) == 0 {
+		return nil
+	}
+	host := strings.ToLower(EndpointHost(endpoint))
+	for _, a := range allowed {
+		a = strings.ToLower(a)
+		if host == a {
+			return nil
+		}
+		if suffix, ok := strings.CutPrefix(a, "*"); ok && strings.HasPrefix(suffix, ".") && strings.HasSuffix(host, suffix) {
+			return nil
+		}
+	}
+	return fmt.Errorf("refusing to contact %s: host is not in ai-commit.allowedHosts (%s)", host, strings.Join(allowed, ", "))
+}
+
+// unixScheme prefixes endpoints served over a Unix domain socket, written as
+// unix:///path/to.sock:/v1 — the socket path, a colon, then the HTTP path.
+const unixScheme = "unix://"
+
+// SplitUnixEndpoint splits a unix:///path/to.sock:/http/path endpoint into
+// the socket path and an http://localhost URL for the HTTP path. ok is false
+// for any other endpoint.
+func SplitUnixEndpoint(endpoint string) (socket, httpURL string, ok bool) {
+	rest, ok := strings.CutPrefix(endpoint, unixScheme)
+	if !ok {
+		return "", "", false
+	}
+	socket, httpPath, _ := strings.Cut(rest, ":")
+	return socket, "http://localhost" + "/" + strings.TrimPrefix(httpPath, "/"), true
+}
+
+// RequestURL returns the URL an HTTP request to endpoint is made for: the
+// endpoint itself, or for a Unix socket endpoint the http://localhost URL of
+// its HTTP path (the client dials the socket, see NewHTTPClient).
+func RequestURL(endpoint string) string {
+	if _, u, ok := SplitUnixEndpoint(endpoint); ok {
+		return u
+	}
+	return endpoint
+}
+
+// ResolveChatCompletionsEndpoint turns a configured base URL into the full
+// chat-completions URL, inserting /v1 when the base has no API version.
+func ResolveChatCompletionsEndpoint(raw string) (string, error) {
+	return resolveChatCompletionsEndpoint(raw, false)
+}
+
+// resolveAzureEndpoint builds the Azure OpenAI chat-completions URL,
+// https://{resource}.openai.azure.com/openai/deployments/{deployment}/chat/completions?api-version=...,
+// from the resource base URL. Unlike the OpenAI style, the api-version query
+// parameter is required and therefore kept.
+func resolveAzureEndpoint(raw, deployment, apiVersion string) (string, error) {
+	if deployment == "" {
+		return "", errors.New("ai-commit.azureDeployment is required when ai-commit.apiStyle is azure")
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("endpoint %q must be the resource URL, e.g. https://my-resource.openai.azure.com", raw)
+	}
+
+	// Accept a bare resource URL as well as one that already carries the
+	// /openai prefix; everything from /openai onwards is rebuilt.
+	base := u.Path
+	if i := strings.Index(base, "/openai"); i >= 0 {
+		base = base[:i]
+	}
+	u.Path = path.Join("/", base, "openai", "deployments", deployment, "chat", "completions")
+	u.RawPath = ""
+	u.RawQuery = url.Values{"api-version": {apiVersion}}.Encode()
+	return u.String(), nil
+}
+
+// apiVersionSegment matches path segments that name an API version, such as
+// v1, v2, v1beta or v1alpha2.
+var apiVersionSegment = regexp.MustCompile(`^v[0-9]+([a-z]+[0-9]*)?$`)
+
+// resolveChatCompletionsEndpoint implements ResolveChatCompletionsEndpoint.
+// When rawEndpoint is true (ai-commit.rawEndpoint) the path is taken as-is and
+// only /chat/completions is appended, which suits providers such as Azure
+// whose OpenAI-compatible path is not versioned.
+func resolveChatCompletionsEndpoint(raw string, rawEndpoint bool) (string, error) {
+	if raw == "" {
+		return "", nil
+	}
+
+	// Only the HTTP path of a socket endpoint is normalised; the socket path
+	// is kept exactly as written.
+	if socket, httpURL, ok := SplitUnixEndpoint(raw); ok {
+		if socket == "" {
+			return "", errors.New("unix endpoint has no socket path (expected unix:///path/to.sock:/v1)")
+		}
+		resolved, err := resolveChatCompletionsEndpoint(httpURL, rawEndpoint)
+		if err != nil {
+			return "", err
+		}
+		return unixScheme + socket + ":" + strings.TrimPrefix(resolved, "http://localhost"), nil
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+
+	// Normalize path
+	cleanPath := path.Clean("/" + strings.TrimPrefix(u.Path, "/"))
+
+	// Remove existing /chat/completions if already present
+	cleanPath = strings.TrimSuffix(cleanPath, "/chat/completions")
+
+	// Ensure we have an API version segment, unless the base already ends in
+	// one (v1, v1beta, ...) or in an OpenAI-compatible segment (e.g. Gemini's
+	// /v1beta/openai), in which case it is used as-is.
+	last := path.Base(cleanPath)
+	if !rawEndpoint && !apiVersionSegment.MatchString(last) && last != "openai" {
+		cleanPath = path.Join(cleanPath, "v1")
+	}
+
+	// Append final path
+	cleanPath = path.Join(cleanPath, "chat", "completions")
+
+	u.Path = cleanPath
+	u.RawQuery = "" // Defensive: remove accidental query params
+
+	return u.String(), nil
+}
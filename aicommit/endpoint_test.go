@@ -0,0 +1,156 @@
+package aicommit
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveChatCompletionsEndpoint(t *testing.T) {
+	tests := []struct {
+		raw         string
+		rawEndpoint bool
+		want        string
+	}{
+		{"", false, ""},
+		{"https://api.openai.com", false, "https://api.openai.com/v1/chat/completions"},
+		{"https://api.openai.com/", false, "https://api.openai.com/v1/chat/completions"},
+		{"https://api.openai.com/v1", false, "https://api.openai.com/v1/chat/completions"},
+		{"https://api.openai.com/v1/", false, "https://api.openai.com/v1/chat/completions"},
+		{"https://api.openai.com/v1/chat/completions", false, "https://api.openai.com/v1/chat/completions"},
+		{"https://api.openai.com/chat/completions", false, "https://api.openai.com/v1/chat/completions"},
+		{"https://example.com/proxy", false, "https://example.com/proxy/v1/chat/completions"},
+		{"https://example.com/api/v2", false, "https://example.com/api/v2/chat/completions"},
+		{"https://example.com//v1//", false, "https://example.com/v1/chat/completions"},
+		{"https://example.com/v1?foo=bar", false, "https://example.com/v1/chat/completions"},
+		{"https://example.com/proxy", true, "https://example.com/proxy/chat/completions"},
+		{"https://example.com/proxy/chat/completions", true, "https://example.com/proxy/chat/completions"},
+	}
+	for _, tt := range tests {
+		got, err := resolveChatCompletionsEndpoint(tt.raw, tt.rawEndpoint)
+		if err != nil {
+			t.Errorf("resolveChatCompletionsEndpoint(%q, %v): %v", tt.raw, tt.rawEndpoint, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("resolveChatCompletionsEndpoint(%q, %v) = %q, want %q", tt.raw, tt.rawEndpoint, got, tt.want)
+		}
+	}
+}
+
+func TestResolveChatCompletionsEndpointProviders(t *testing.T) {
+	tests := []struct {
+		name        string
+		raw         string
+		rawEndpoint bool
+		want        string
+	}{
+		{"openai", "https://api.openai.com", false, "https://api.openai.com/v1/chat/completions"},
+		{"ollama", "http://localhost:11434", false, "http://localhost:11434/v1/chat/completions"},
+		{"ollama with v1", "http://localhost:11434/v1", false, "http://localhost:11434/v1/chat/completions"},
+		{"gemini", "https://generativelanguage.googleapis.com/v1beta/openai", false, "https://generativelanguage.googleapis.com/v1beta/openai/chat/completions"},
+		{"gemini with trailing slash", "https://generativelanguage.googleapis.com/v1beta/openai/", false, "https://generativelanguage.googleapis.com/v1beta/openai/chat/completions"},
+		{"version segment", "https://example.com/api/v1alpha2", false, "https://example.com/api/v1alpha2/chat/completions"},
+		{"azure deployment, raw", "https://res.openai.azure.com/openai/deployments/gpt4o", true, "https://res.openai.azure.com/openai/deployments/gpt4o/chat/completions"},
+		{"openai, raw", "https://api.openai.com", true, "https://api.openai.com/chat/completions"},
+		{"unix socket", "unix:///tmp/llm.sock:/", false, "unix:///tmp/llm.sock:/v1/chat/completions"},
+		{"unix socket with version", "unix:///tmp/llm.sock:/v1", false, "unix:///tmp/llm.sock:/v1/chat/completions"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveChatCompletionsEndpoint(tt.raw, tt.rawEndpoint)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("resolveChatCompletionsEndpoint(%q, %v) = %q, want %q", tt.raw, tt.rawEndpoint, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveAzureEndpoint(t *testing.T) {
+	const want = "https://res.openai.azure.com/openai/deployments/gpt4o/chat/completions?api-version=2024-10-21"
+	for _, raw := range []string{
+		"https://res.openai.azure.com",
+		"https://res.openai.azure.com/",
+		"https://res.openai.azure.com/openai",
+		"https://res.openai.azure.com/openai/deployments/old/chat/completions?api-version=2023-05-15",
+	} {
+		got, err := resolveAzureEndpoint(raw, "gpt4o", "2024-10-21")
+		if err != nil {
+			t.Errorf("resolveAzureEndpoint(%q): %v", raw, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("resolveAzureEndpoint(%q) = %q, want %q", raw, got, want)
+		}
+	}
+
+	if _, err := resolveAzureEndpoint("https://res.openai.azure.com", "", "2024-10-21"); err == nil {
+		t.Error("expected an error without a deployment")
+	}
+	if _, err := resolveAzureEndpoint("res.openai.azure.com", "gpt4o", "2024-10-21"); err == nil {
+		t.Error("expected an error for an endpoint without a scheme")
+	}
+}
+
+func TestSplitUnixEndpoint(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		socket   string
+		httpURL  string
+		ok       bool
+	}{
+		{"unix:///run/llm.sock:/v1/chat/completions", "/run/llm.sock", "http://localhost/v1/chat/completions", true},
+		{"unix:///run/llm.sock", "/run/llm.sock", "http://localhost/", true},
+		{"unix:///run/llm.sock:v1", "/run/llm.sock", "http://localhost/v1", true},
+		{"http://localhost:8080/v1", "", "", false},
+	}
+	for _, tt := range tests {
+		socket, httpURL, ok := SplitUnixEndpoint(tt.endpoint)
+		if socket != tt.socket || httpURL != tt.httpURL || ok != tt.ok {
+			t.Errorf("SplitUnixEndpoint(%q) = %q, %q, %v; want %q, %q, %v",
+				tt.endpoint, socket, httpURL, ok, tt.socket, tt.httpURL, tt.ok)
+		}
+	}
+}
+
+func TestUnixSocketEndpoint(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "llm.sock")
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	paths := make(chan string, 1)
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths <- r.URL.Path
+		writeChoice(w, "fix: over a socket", "stop")
+	})}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	endpoint, err := resolveChatCompletionsEndpoint("unix://"+socket+":/v1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "unix://" + socket + ":/v1/chat/completions"; endpoint != want {
+		t.Fatalf("endpoint = %q, want %q", endpoint, want)
+	}
+	cfg := Config{Endpoint: endpoint, Model: "m", SystemRole: "system"}
+	got, _, err := CallChatCompletions(context.Background(), cfg, "prompt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "fix: over a socket" {
+		t.Errorf("content = %q", got)
+	}
+	if gotPath := <-paths; gotPath != "/v1/chat/completions" {
+		t.Errorf("server saw path %q", gotPath)
+	}
+	if !IsLocalEndpoint(endpoint) {
+		t.Error("a socket endpoint should count as local")
+	}
+}
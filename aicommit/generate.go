@@ -0,0 +1,452 @@
+package aicommit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Generate returns a commit message for diff, generated with cfg. It is
+// GenerateCommitMessage without the token usage.
+func Generate(ctx context.Context, cfg Config, diff string) (string, error) {
+	msg, _, err := GenerateCommitMessage(ctx, cfg, diff)
+	return msg, err
+}
+
+// GenerateCommitMessage builds the prompt for diff, queries the LLM and
+// returns the sanitized commit message. It is shared by the hook and show.
+func GenerateCommitMessage(ctx context.Context, cfg Config, diff string) (string, Usage, error) {
+	cfg, err := withHTTPClient(cfg)
+	if err != nil {
+		return "", Usage{}, err
+	}
+	cfg = withHistory(cfg)
+	diff = RedactDiff(cfg, diff)
+	if cfg.IncludeBody && isSmallDiff(diff, cfg.BodyThresholdLines) {
+		Debugf("small single-file diff: requesting subject only")
+		cfg.IncludeBody = false
+	}
+	var usage Usage
+	if cfg.Chunked && len(diff) > cfg.ChunkBytes {
+		summaries, more, err := summarizeDiff(ctx, cfg, diff)
+		usage.add(more)
+		if err != nil {
+			return "", usage, err
+		}
+		diff = summaries
+	}
+	prompt := BuildPrompt(cfg, diff)
+
+	msg, more, err := callCommitMessage(ctx, &cfg, prompt)
+	usage.add(more)
+	if err == nil {
+		msg = cleanCommitMessage(cfg, msg)
+	}
+	msg, more, err = refineCommitMessage(ctx, &cfg, prompt, msg, err)
+	usage.add(more)
+	return msg, usage, err
+}
+
+// refineCommitMessage takes the cleaned first answer to prompt (or the error
+// requesting it) through the checks that may ask the model again: an empty
+// answer, banned phrases and an invalid type. Problems that remain are
+// printed as warnings.
+func refineCommitMessage(ctx context.Context, cfg *Config, prompt, msg string, err error) (string, Usage, error) {
+	var usage Usage
+	// An empty answer is usually a fluke; with ai-commit.retryOnEmpty, ask
+	// once more with a nudge before giving up.
+	if cfg.RetryOnEmpty && (errors.Is(err, errEmptyMessage) || err == nil && msg == "") {
+		Debugf("empty message; retrying once")
+		var more Usage
+		msg, more, err = callCommitMessage(ctx, cfg, prompt+"\n\nYour previous answer was empty. Reply with the commit message itself, following the requirements above.")
+		usage.add(more)
+		if err == nil {
+			msg = cleanCommitMessage(*cfg, msg)
+		}
+	}
+	if err != nil {
+		return "", usage, err
+	}
+	if msg == "" {
+		return "", usage, errors.New("LLM returned empty commit message")
+	}
+
+	// Reject vague filler: regenerate once with a corrective instruction,
+	// and warn (without failing) if the second attempt still uses it.
+	if found := findBannedPhrases(msg, cfg.BannedPhrases); len(found) > 0 {
+		retry := prompt + "\n\n" + fmt.Sprintf(
+			"Your previous answer used vague phrases (%s). Write a more specific message that names the concrete changes, and do not use those phrases.",
+			strings.Join(found, ", "))
+		second, more, err := callCommitMessage(ctx, cfg, retry)
+		usage.add(more)
+		if err == nil {
+			if second = cleanCommitMessage(*cfg, second); second != "" {
+				msg = second
+			}
+		}
+		if found := findBannedPhrases(msg, cfg.BannedPhrases); len(found) > 0 {
+			fmt.Fprintf(os.Stderr, "git-ai-commit: warning: message still contains banned phrases: %s\n", strings.Join(found, ", "))
+		}
+	}
+
+	// With ai-commit.enforceType, give the model one more chance to use a
+	// valid Conventional Commits type.
+	if cfg.EnforceType && typeProblem(*cfg, msg) != "" {
+		retry := prompt + "\n\n" + fmt.Sprintf(
+			"Your previous subject was %q. Start the subject with one of the allowed types (%s) followed by a colon and a space.",
+			firstLine(msg), strings.Join(allowedTypes(*cfg), ", "))
+		second, more, err := callCommitMessage(ctx, cfg, retry)
+		usage.add(more)
+		if err == nil {
+			if second = cleanCommitMessage(*cfg, second); second != "" {
+				msg = second
+			}
+		}
+	}
+
+	// Models don't always obey the prompt; surface problems without failing.
+	for _, problem := range validateCommitMessage(*cfg, msg) {
+		fmt.Fprintf(os.Stderr, "git-ai-commit: warning: %s\n", problem)
+	}
+
+	return msg, usage, nil
+}
+
+// callCommitMessage requests a commit message for prompt. With
+// ai-commit.structured it asks for a JSON object via response_format and
+// formats it as subject plus bullets; a provider that rejects
+// response_format gets the plain request instead, and cfg.Structured is
+// cleared so later retries in the same run don't try again. Unless
+// ai-commit.maxTokens is set, the request is capped by commitTokenCap.
+func callCommitMessage(ctx context.Context, cfg *Config, prompt string) (string, Usage, error) {
+	req := *cfg
+	if req.MaxTokens < 0 {
+		req.MaxTokens = commitTokenCap(req)
+	}
+	if !cfg.Structured {
+		return CallChatCompletions(ctx, req, prompt)
+	}
+	raw, usage, err := requestChatCompletion(ctx, req, prompt+structuredOutputNote, commitMessageFormat)
+	if formatRejected(err) {
+		Debugf("structured output rejected (%v); retrying without response_format", err)
+		cfg.Structured = false
+		msg, more, err := CallChatCompletions(ctx, req, prompt)
+		usage.add(more)
+		return msg, usage, err
+	}
+	if err != nil {
+		return "", usage, err
+	}
+	if msg, ok := parseStructuredMessage(raw); ok {
+		return msg, usage, nil
+	}
+	// Not the JSON we asked for; treat it as a plain-text message.
+	return raw, usage, nil
+}
+
+// formatRejected reports whether err is the provider refusing a request
+// because of its response_format.
+func formatRejected(err error) bool {
+	var apiErr *apiError
+	return errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusBadRequest || apiErr.StatusCode == http.StatusUnprocessableEntity)
+}
+
+// reasoningTokenAllowance is added to the visible-text estimate in
+// commitTokenCap, because reasoning models (including the default
+// gpt-5-nano) spend completion tokens thinking before they write anything.
+const reasoningTokenAllowance = 4096
+
+// commitTokenCap derives a completion token cap for a commit message from
+// the requested shape: a subject of cfg.SubjectMaxLen characters and, with a
+// body, up to seven bullets of two wrapped lines each. Characters are counted
+// as half a token, which overestimates for English text, and
+// reasoningTokenAllowance is added on top. The cap only stops runaway
+// generations; it is far above what a normal message needs.
+func commitTokenCap(cfg Config) int {
+	chars := cfg.SubjectMaxLen
+	if cfg.IncludeBody {
+		chars += 7 * 2 * cfg.WrapWidth
+	}
+	return chars/2 + reasoningTokenAllowance
+}
+
+// structuredOutputNote overrides the prompt's plain-text output rule when
+// response_format is used.
+const structuredOutputNote = `
+
+Output format override: respond with a JSON object {"subject": "<subject line>", "bullets": ["<bullet text>", ...]}. Put each bullet point in the bullets list without the leading "- ", and use an empty list when only a subject is wanted.`
+
+// parseStructuredMessage turns a {"subject", "bullets"} JSON response into a
+// commit message: the subject, a blank line and one "- " line per bullet.
+func parseStructuredMessage(raw string) (string, bool) {
+	var parsed struct {
+		Subject string   `json:"subject"`
+		Bullets []string `json:"bullets"`
+	}
+	obj := extractJSONObject(raw)
+	if obj == "" || json.Unmarshal([]byte(obj), &parsed) != nil || strings.TrimSpace(parsed.Subject) == "" {
+		return "", false
+	}
+	var b strings.Builder
+	b.WriteString(strings.TrimSpace(parsed.Subject))
+	first := true
+	for _, bullet := range parsed.Bullets {
+		bullet = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(bullet), "- "))
+		if bullet == "" {
+			continue
+		}
+		if first {
+			b.WriteString("\n")
+			first = false
+		}
+		b.WriteString("\n- " + bullet)
+	}
+	return b.String(), true
+}
+
+// validateCommitMessage checks msg against the configured conventions and
+// returns a description of each problem found. An empty result means the
+// message passed every check.
+func validateCommitMessage(cfg Config, msg string) []string {
+	var problems []string
+	subject, _, _ := strings.Cut(msg, "\n")
+	if n := utf8.RuneCountInString(subject); cfg.SubjectMaxLen > 0 && n > cfg.SubjectMaxLen {
+		problems = append(problems, fmt.Sprintf("subject line is %d characters, longer than the configured maximum of %d", n, cfg.SubjectMaxLen))
+	}
+	if p := typeProblem(cfg, msg); p != "" {
+		problems = append(problems, p)
+	}
+	if p := scopeProblem(cfg, msg); p != "" {
+		problems = append(problems, p)
+	}
+	return problems
+}
+
+// scopeProblem reports a subject scope that is not in ai-commit.scopes. A
+// subject without a scope is fine; so is any scope when the list is empty.
+func scopeProblem(cfg Config, msg string) string {
+	if cfg.Style == "plain" || len(cfg.Scopes) == 0 {
+		return ""
+	}
+	scope := subjectScope(msg)
+	if scope == "" {
+		return ""
+	}
+	for _, s := range cfg.Scopes {
+		if strings.EqualFold(s, scope) {
+			return ""
+		}
+	}
+	return fmt.Sprintf("subject scope %q is not one of %s", scope, strings.Join(cfg.Scopes, ", "))
+}
+
+// typeProblem describes what is wrong with the Conventional Commits type of
+// msg's subject, or returns "" when it is valid or the plain style is used.
+func typeProblem(cfg Config, msg string) string {
+	if cfg.Style == "plain" {
+		return ""
+	}
+	typ, ok := subjectType(msg)
+	if !ok {
+		return fmt.Sprintf("subject %q does not start with a Conventional Commits type", firstLine(msg))
+	}
+	for _, t := range allowedTypes(cfg) {
+		if strings.EqualFold(t, typ) {
+			return ""
+		}
+	}
+	return fmt.Sprintf("subject type %q is not one of %s", typ, strings.Join(allowedTypes(cfg), ", "))
+}
+
+// allowedTypes returns the built-in Conventional Commits types followed by
+// ai-commit.extraTypes.
+func allowedTypes(cfg Config) []string {
+	types := make([]string, 0, len(conventionalTypes)+len(cfg.ExtraTypes))
+	for _, t := range conventionalTypes {
+		types = append(types, t.Name)
+	}
+	return append(types, cfg.ExtraTypes...)
+}
+
+// subjectType returns the Conventional Commits type of msg's subject,
+// ignoring a leading gitmoji.
+func subjectType(msg string) (string, bool) {
+	m := matchSubject(msg)
+	if m == nil {
+		return "", false
+	}
+	return m[1], true
+}
+
+// subjectScope returns the scope of msg's subject without its parentheses,
+// or "" when it has none.
+func subjectScope(msg string) string {
+	m := matchSubject(msg)
+	if m == nil || m[2] == "" {
+		return ""
+	}
+	return strings.TrimSpace(m[2][1 : len(m[2])-1])
+}
+
+// matchSubject matches subjectTypePattern against msg's subject, ignoring a
+// leading gitmoji.
+func matchSubject(msg string) []string {
+	bare := strings.TrimLeftFunc(firstLine(msg), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return subjectTypePattern.FindStringSubmatch(bare)
+}
+
+// firstLine returns s up to its first newline.
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
+
+// GenerateShortAndLong asks for a subject-only message and a full message in
+// a single request, as a {"short", "long"} JSON object via response_format.
+// A provider that rejects response_format gets the same prompt, which also
+// asks for the JSON object, without it. If no object can be parsed, the whole
+// response is treated as the long form. The long form then goes through the
+// same checks as GenerateCommitMessage; when one of them replaces it, or the
+// model gave no short form, the short form is the long form's subject.
+func GenerateShortAndLong(ctx context.Context, cfg Config, diff string) (short, long string, usage Usage, err error) {
+	if cfg, err = withHTTPClient(cfg); err != nil {
+		return "", "", usage, err
+	}
+	cfg = withHistory(cfg)
+	diff = RedactDiff(cfg, diff)
+	if cfg.Chunked && len(diff) > cfg.ChunkBytes {
+		summaries, more, err := summarizeDiff(ctx, cfg, diff)
+		usage.add(more)
+		if err != nil {
+			return "", "", usage, err
+		}
+		diff = summaries
+	}
+	raw, more, err := callShortAndLong(ctx, &cfg, buildBothPrompt(cfg, diff))
+	usage.add(more)
+	if err == nil {
+		short, long = parseShortAndLong(raw)
+		long = cleanCommitMessage(cfg, long)
+	}
+	first := long
+	long, more, err = refineCommitMessage(ctx, &cfg, BuildPrompt(cfg, diff), long, err)
+	usage.add(more)
+	if err != nil {
+		return "", "", usage, err
+	}
+	if short == "" || long != first {
+		short = long
+	}
+	return strings.TrimSpace(firstLine(short)), long, usage, nil
+}
+
+// shortAndLongFormat is the response_format used by GenerateShortAndLong.
+var shortAndLongFormat = &responseFormat{
+	Type: "json_schema",
+	JSONSchema: map[string]any{
+		"name":   "short_and_long_commit_message",
+		"strict": true,
+		"schema": map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"short": map[string]any{"type": "string"},
+				"long":  map[string]any{"type": "string"},
+			},
+			"required":             []string{"short", "long"},
+			"additionalProperties": false,
+		},
+	},
+}
+
+// callShortAndLong sends prompt with shortAndLongFormat. Like
+// callCommitMessage, it repeats the request without response_format when the
+// provider rejects it, and clears cfg.Structured so later retries don't try
+// structured output again.
+func callShortAndLong(ctx context.Context, cfg *Config, prompt string) (string, Usage, error) {
+	raw, usage, err := requestChatCompletion(ctx, *cfg, prompt, shortAndLongFormat)
+	if formatRejected(err) {
+		Debugf("structured output rejected (%v); retrying without response_format", err)
+		cfg.Structured = false
+		raw, more, err := CallChatCompletions(ctx, *cfg, prompt)
+		usage.add(more)
+		return raw, usage, err
+	}
+	return raw, usage, err
+}
+
+// parseShortAndLong splits a {"short", "long"} response. A response without
+// a JSON object is returned whole as the long form; an object with an empty
+// long form yields an empty one, for refineCommitMessage to retry.
+func parseShortAndLong(raw string) (short, long string) {
+	var parsed struct {
+		Short string `json:"short"`
+		Long  string `json:"long"`
+	}
+	if obj := extractJSONObject(raw); obj != "" && json.Unmarshal([]byte(obj), &parsed) == nil {
+		return strings.TrimSpace(parsed.Short), parsed.Long
+	}
+	return "", raw
+}
+
+// summarizeDiff splits a diff that is too large for one request into groups
+// of whole files of at most cfg.ChunkBytes, asks for a short summary of each
+// group, and returns the summaries in a form BuildPrompt can use in place of
+// the diff. All requests share ctx, so ai-commit.timeoutSeconds still bounds
+// the whole run.
+func summarizeDiff(ctx context.Context, cfg Config, diff string) (string, Usage, error) {
+	var usage Usage
+
+	// Keep any note before the first file (e.g. a partial-selection marker)
+	// with the first group.
+	preamble := diff
+	if i := strings.Index(diff, "diff --git "); i >= 0 {
+		preamble = diff[:i]
+	}
+	var groups []string
+	current := preamble
+	for _, section := range splitDiffFiles(diff) {
+		section = TruncateDiff(section, cfg.ChunkBytes)
+		if strings.TrimSpace(current) != "" && len(current)+len(section) > cfg.ChunkBytes {
+			groups = append(groups, current)
+			current = ""
+		}
+		current += section
+	}
+	if strings.TrimSpace(current) != "" {
+		groups = append(groups, current)
+	}
+
+	var b strings.Builder
+	b.WriteString("[this diff was too large for one request; below are summaries of each part, in order. Write one commit message that covers all of them.]\n")
+	for i, group := range groups {
+		Debugf("summarizing part %d/%d (%d bytes)", i+1, len(groups), len(group))
+		summary, more, err := CallChatCompletions(ctx, cfg,
+			"Summarize this part of a staged Git diff in 1-5 short bullet points (\"- \"). "+
+				"Name the files and the concrete changes. Output only the bullet points.\n\nDiff:\n"+group)
+		usage.add(more)
+		if err != nil {
+			return "", usage, fmt.Errorf("summarize part %d of %d: %w", i+1, len(groups), err)
+		}
+		fmt.Fprintf(&b, "\nPart %d of %d:\n%s\n", i+1, len(groups), strings.TrimSpace(summary))
+	}
+	return b.String(), usage, nil
+}
+
+// extractJSONObject returns the outermost {...} span of s, which tolerates
+// models that wrap JSON in code fences or add a sentence around it.
+func extractJSONObject(s string) string {
+	start := strings.Index(s, "{")
+	end := strings.LastIndex(s, "}")
+	if start < 0 || end <= start {
+		return ""
+	}
+	return s[start : end+1]
+}
@@ -0,0 +1,414 @@
+package aicommit
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// scriptedServer answers successive chat completions requests with replies,
+// repeating the last one, and records each request it receives.
+type scriptedServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []chatCompletionsRequest
+}
+
+func newScriptedServer(t *testing.T, replies ...string) *scriptedServer {
+	t.Helper()
+	s := &scriptedServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req chatCompletionsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		s.mu.Lock()
+		s.requests = append(s.requests, req)
+		reply := replies[min(len(s.requests), len(replies))-1]
+		s.mu.Unlock()
+		writeChoice(w, reply, "stop")
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// prompts returns the user prompt of each request received so far.
+func (s *scriptedServer) prompts() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []string
+	for _, req := range s.requests {
+		out = append(out, req.Messages[len(req.Messages)-1].Content)
+	}
+	return out
+}
+
+func TestTypeProblem(t *testing.T) {
+	tests := []struct {
+		subject string
+		extra   []string
+		valid   bool
+	}{
+		{"feat: add login", nil, true},
+		{"fix(api): handle nil body", nil, true},
+		{"feat(cli)!: drop --legacy", nil, true},
+		{"FIX: shout", nil, true},
+		{"✨ feat: add login", nil, true},
+		{"update: bump deps", nil, false},
+		{"feature: add login", nil, false},
+		{"bugfix: handle nil body", nil, false},
+		{"fixed: handle nil body", nil, false},
+		{"Add login", nil, false},
+		{"feat add login", nil, false},
+		{"wip: half done", nil, false},
+		{"wip: half done", []string{"wip"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.subject, func(t *testing.T) {
+			cfg := Config{Style: "conventional", ExtraTypes: tt.extra}
+			problem := typeProblem(cfg, tt.subject+"\n\n- body\n")
+			if (problem == "") != tt.valid {
+				t.Errorf("typeProblem(%q) = %q, want valid=%v", tt.subject, problem, tt.valid)
+			}
+			if problems := validateCommitMessage(cfg, tt.subject); (len(problems) == 0) != tt.valid {
+				t.Errorf("validateCommitMessage(%q) = %q, want valid=%v", tt.subject, problems, tt.valid)
+			}
+		})
+	}
+
+	if p := typeProblem(Config{Style: "plain"}, "update: anything goes"); p != "" {
+		t.Errorf("plain style: typeProblem = %q, want none", p)
+	}
+}
+
+func TestValidateCommitMessage(t *testing.T) {
+	cfg := Config{Style: "conventional", SubjectMaxLen: 20, Scopes: []string{"api", "cli"}}
+	tests := []struct {
+		msg  string
+		want []string
+	}{
+		{"fix(api): nil body", nil},
+		{"fix: nil body", nil},
+		{"fix(api): handle a nil request body", []string{"longer than the configured maximum of 20"}},
+		{"fix(web): nil body", []string{`subject scope "web" is not one of api, cli`}},
+		{"update(web): a much longer subject", []string{"longer than", `subject type "update"`, `subject scope "web"`}},
+	}
+	for _, tt := range tests {
+		problems := validateCommitMessage(cfg, tt.msg)
+		if len(problems) != len(tt.want) {
+			t.Errorf("validateCommitMessage(%q) = %q, want %d problems", tt.msg, problems, len(tt.want))
+			continue
+		}
+		for i, want := range tt.want {
+			if !strings.Contains(problems[i], want) {
+				t.Errorf("validateCommitMessage(%q)[%d] = %q, want %q", tt.msg, i, problems[i], want)
+			}
+		}
+	}
+}
+
+func TestEnforceTypeRegenerates(t *testing.T) {
+	srv := newScriptedServer(t, "update: bump dependencies", "chore: bump dependencies")
+	cfg := clientConfig(srv.Server)
+	cfg.Style = "conventional"
+	cfg.EnforceType = true
+
+	msg, _, err := GenerateCommitMessage(context.Background(), cfg, "diff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg != "chore: bump dependencies\n" {
+		t.Errorf("message = %q, want the regenerated one", msg)
+	}
+	prompts := srv.prompts()
+	if len(prompts) != 2 {
+		t.Fatalf("%d requests, want 2", len(prompts))
+	}
+	if !strings.Contains(prompts[1], `Your previous subject was "update: bump dependencies"`) {
+		t.Errorf("retry prompt lacks the corrective instruction:\n%s", prompts[1])
+	}
+}
+
+// captureStderr runs f with os.Stderr redirected and returns what it wrote.
+func captureStderr(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := os.Stderr
+	os.Stderr = w
+	defer func() { os.Stderr = saved }()
+	done := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		done <- string(b)
+	}()
+	f()
+	w.Close()
+	return <-done
+}
+
+func TestBannedPhrasesRegenerate(t *testing.T) {
+	tests := []struct {
+		name     string
+		replies  []string
+		want     string
+		wantWarn bool
+	}{
+		{"retry is specific", []string{"chore: various changes", "chore: bump Go to 1.25"}, "chore: bump Go to 1.25\n", false},
+		{"retry still vague", []string{"chore: various changes", "chore: Various Changes to deps"}, "chore: Various Changes to deps\n", true},
+		{"empty retry keeps the first answer", []string{"chore: various changes", ""}, "chore: various changes\n", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newScriptedServer(t, tt.replies...)
+			cfg := clientConfig(srv.Server)
+			cfg.Style = "conventional"
+			cfg.BannedPhrases = []string{"various changes", "misc updates"}
+
+			var msg string
+			var err error
+			stderr := captureStderr(t, func() {
+				msg, _, err = GenerateCommitMessage(context.Background(), cfg, "diff")
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if msg != tt.want {
+				t.Errorf("message = %q, want %q", msg, tt.want)
+			}
+			prompts := srv.prompts()
+			if len(prompts) != 2 {
+				t.Fatalf("%d requests, want 2", len(prompts))
+			}
+			if !strings.Contains(prompts[1], "vague phrases (various changes)") {
+				t.Errorf("retry prompt lacks the corrective instruction:\n%s", prompts[1])
+			}
+			if got := strings.Contains(stderr, "still contains banned phrases: various changes"); got != tt.wantWarn {
+				t.Errorf("warning printed = %v, want %v; stderr:\n%s", got, tt.wantWarn, stderr)
+			}
+		})
+	}
+}
+
+func TestParseStructuredMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want string
+		ok   bool
+	}{
+		{"subject and bullets", `{"subject":"feat: add login","bullets":["add the form","- store the session"]}`, "feat: add login\n\n- add the form\n- store the session", true},
+		{"subject only", `{"subject":"fix: typo","bullets":[]}`, "fix: typo", true},
+		{"blank bullets dropped", `{"subject":" fix: typo ","bullets":["", "  "]}`, "fix: typo", true},
+		{"fenced", "```json\n{\"subject\":\"docs: update\",\"bullets\":[\"fix links\"]}\n```", "docs: update\n\n- fix links", true},
+		{"missing subject", `{"bullets":["x"]}`, "", false},
+		{"not json", "feat: add login", "", false},
+		{"broken json", `{"subject": "feat: add`, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseStructuredMessage(tt.raw)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("parseStructuredMessage(%q) = %q, %v; want %q, %v", tt.raw, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestStructuredRoundTrip(t *testing.T) {
+	reply, err := json.Marshal(map[string]any{
+		"subject": "feat(auth): add OAuth2 login",
+		"bullets": []string{"add the login form", "store the session token"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := newScriptedServer(t, string(reply))
+	cfg := clientConfig(srv.Server)
+	cfg.Style = "conventional"
+	cfg.Structured = true
+
+	msg, _, err := GenerateCommitMessage(context.Background(), cfg, "diff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "feat(auth): add OAuth2 login\n\n- add the login form\n- store the session token\n"; msg != want {
+		t.Errorf("message = %q, want %q", msg, want)
+	}
+
+	srv.mu.Lock()
+	req := srv.requests[0]
+	srv.mu.Unlock()
+	if req.ResponseFormat == nil || req.ResponseFormat.Type != "json_schema" || req.ResponseFormat.JSONSchema["name"] != commitMessageFormat.JSONSchema["name"] {
+		t.Errorf("response_format = %+v, want the commit message schema", req.ResponseFormat)
+	}
+	if !strings.Contains(srv.prompts()[0], "respond with a JSON object") {
+		t.Error("prompt lacks the structured output note")
+	}
+}
+
+func TestStructuredRejected(t *testing.T) {
+	var withFormat, without atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req chatCompletionsRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.ResponseFormat != nil {
+			withFormat.Add(1)
+			writeError(w, http.StatusBadRequest, "response_format is not supported")
+			return
+		}
+		without.Add(1)
+		writeChoice(w, "fix: plain answer", "stop")
+	}))
+	defer srv.Close()
+
+	cfg := clientConfig(srv)
+	cfg.Style = "conventional"
+	cfg.Structured = true
+	msg, _, err := GenerateCommitMessage(context.Background(), cfg, "diff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg != "fix: plain answer\n" {
+		t.Errorf("message = %q", msg)
+	}
+	if withFormat.Load() != 1 || without.Load() != 1 {
+		t.Errorf("%d structured and %d plain requests, want 1 and 1", withFormat.Load(), without.Load())
+	}
+}
+
+func TestRetryOnEmpty(t *testing.T) {
+	tests := []struct {
+		name         string
+		retryOnEmpty bool
+		replies      []string
+		want         string
+		wantErr      string
+		wantRequests int
+	}{
+		{"retry succeeds", true, []string{"", "fix: handle nil body"}, "fix: handle nil body\n", "", 2},
+		{"empty after cleaning", true, []string{"```\n```", "fix: handle nil body"}, "fix: handle nil body\n", "", 2},
+		{"retry also empty", true, []string{"", ""}, "", "empty message", 2},
+		{"disabled", false, []string{"", "fix: handle nil body"}, "", "empty message", 1},
+		{"first answer fine", true, []string{"fix: first"}, "fix: first\n", "", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newScriptedServer(t, tt.replies...)
+			cfg := clientConfig(srv.Server)
+			cfg.Style = "conventional"
+			cfg.RetryOnEmpty = tt.retryOnEmpty
+
+			msg, _, err := GenerateCommitMessage(context.Background(), cfg, "diff")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("error = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if msg != tt.want {
+				t.Errorf("message = %q, want %q", msg, tt.want)
+			}
+			prompts := srv.prompts()
+			if len(prompts) != tt.wantRequests {
+				t.Fatalf("%d requests, want %d", len(prompts), tt.wantRequests)
+			}
+			if len(prompts) == 2 && !strings.Contains(prompts[1], "Your previous answer was empty.") {
+				t.Errorf("retry prompt lacks the nudge:\n%s", prompts[1])
+			}
+		})
+	}
+}
+
+func TestGenerateShortAndLong(t *testing.T) {
+	both := func(short, long string) string {
+		b, err := json.Marshal(map[string]string{"short": short, "long": long})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+	tests := []struct {
+		name         string
+		replies      []string
+		banned       []string
+		wantShort    string
+		wantLong     string
+		wantRequests int
+	}{
+		{"structured", []string{both("feat: add login", "feat: add login\n\n- add the form")}, nil, "feat: add login", "feat: add login\n\n- add the form\n", 1},
+		{"no short form", []string{both("", "fix: handle nil body\n\n- check first")}, nil, "fix: handle nil body", "fix: handle nil body\n\n- check first\n", 1},
+		{"not json", []string{"docs: update guide\n\n- fix links"}, nil, "docs: update guide", "docs: update guide\n\n- fix links\n", 1},
+		{"empty long retried", []string{both("", ""), "fix: handle nil body"}, nil, "fix: handle nil body", "fix: handle nil body\n", 2},
+		{"banned phrase regenerates", []string{both("chore: various changes", "chore: various changes"), "chore: bump Go to 1.25"}, []string{"various changes"}, "chore: bump Go to 1.25", "chore: bump Go to 1.25\n", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newScriptedServer(t, tt.replies...)
+			cfg := clientConfig(srv.Server)
+			cfg.Style = "conventional"
+			cfg.RetryOnEmpty = true
+			cfg.BannedPhrases = tt.banned
+
+			short, long, _, err := GenerateShortAndLong(context.Background(), cfg, "diff")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if short != tt.wantShort || long != tt.wantLong {
+				t.Errorf("got %q, %q; want %q, %q", short, long, tt.wantShort, tt.wantLong)
+			}
+			srv.mu.Lock()
+			defer srv.mu.Unlock()
+			if len(srv.requests) != tt.wantRequests {
+				t.Fatalf("%d requests, want %d", len(srv.requests), tt.wantRequests)
+			}
+			if f := srv.requests[0].ResponseFormat; f == nil || f.Type != "json_schema" || f.JSONSchema["name"] != shortAndLongFormat.JSONSchema["name"] {
+				t.Errorf("response_format = %+v, want the short and long schema", f)
+			}
+			for _, req := range srv.requests[1:] {
+				if req.ResponseFormat != nil {
+					t.Errorf("retry sent response_format %+v", req.ResponseFormat)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateShortAndLongRejected(t *testing.T) {
+	var withFormat, without atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req chatCompletionsRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.ResponseFormat != nil {
+			withFormat.Add(1)
+			writeError(w, http.StatusUnprocessableEntity, "response_format is not supported")
+			return
+		}
+		without.Add(1)
+		writeChoice(w, "```json\n{\"short\": \"feat: add login\", \"long\": \"feat: add login\\n\\n- add the form\"}\n```", "stop")
+	}))
+	defer srv.Close()
+
+	cfg := clientConfig(srv)
+	cfg.Style = "conventional"
+	short, long, _, err := GenerateShortAndLong(context.Background(), cfg, "diff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if short != "feat: add login" || long != "feat: add login\n\n- add the form\n" {
+		t.Errorf("got %q, %q", short, long)
+	}
+	if withFormat.Load() != 1 || without.Load() != 1 {
+		t.Errorf("%d structured and %d plain requests, want 1 and 1", withFormat.Load(), without.Load())
+	}
+}
@@ -0,0 +1,289 @@
+package aicommit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// gitBinary is the git executable every git command runs, "git" from PATH
+// unless FindGit picked another one (AI_COMMIT_GIT or ai-commit.gitBinary).
+var gitBinary = "git"
+
+// GitCommand returns an exec.Cmd that runs git with args. All git
+// invocations go through it so that ai-commit.gitBinary applies everywhere.
+func GitCommand(args ...string) *exec.Cmd {
+	return exec.Command(gitBinary, args...)
+}
+
+// gitCommandContext is GitCommand for a git that is killed when ctx is done.
+func gitCommandContext(ctx context.Context, args ...string) *exec.Cmd {
+	return exec.CommandContext(ctx, gitBinary, args...)
+}
+
+// FindGit checks that git can be run before any command needs it, so a
+// missing git produces one clear message instead of a raw exec error from
+// whichever call happens first. The AI_COMMIT_GIT environment variable, or
+// else ai-commit.gitBinary, names the executable used for every later git
+// command. Only the environment variable works when no git is on PATH, since
+// reading git config takes a git.
+func FindGit() error {
+	source := "AI_COMMIT_GIT"
+	v, ok := configFromEnv("ai-commit.gitBinary")
+	if !ok {
+		if _, err := exec.LookPath(gitBinary); err != nil {
+			return errors.New("git not found on PATH; install git, add its directory to PATH, or set AI_COMMIT_GIT to its full path")
+		}
+		source = "ai-commit.gitBinary"
+		v, ok = GitConfigGet("ai-commit.gitBinary")
+	}
+	if v = strings.TrimSpace(v); !ok || v == "" {
+		return nil
+	}
+	path, err := exec.LookPath(ExpandHome(v))
+	if err != nil {
+		return fmt.Errorf("%s: %w", source, err)
+	}
+	gitBinary = path
+	Debugf("using git binary %s (from %s)", path, source)
+	return nil
+}
+
+// GitDir returns the absolute path to the .git directory for the current
+// working directory. It uses `git rev-parse --git-dir` so it works in
+// worktrees and repos with non-standard GIT_DIR locations (including a
+// relative GIT_DIR; see AbsGitPath).
+func GitDir() (string, error) {
+	cmd := GitCommand("rev-parse", "--git-dir")
+	var out bytes.Buffer
+	var errBuf bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &errBuf
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%w: %s", err, strings.TrimSpace(errBuf.String()))
+	}
+	// The path may be relative (e.g. ".git"); make it absolute.
+	return AbsGitPath(strings.TrimSpace(out.String()))
+}
+
+// AbsGitPath makes a path printed by git absolute. Git resolves a relative
+// path (from a relative GIT_DIR, say) against the physical working
+// directory, so it is joined to that rather than to $PWD: when the shell
+// reached the directory through a symlink, a leading ".." would otherwise
+// climb out of the symlink's parent instead of the real one.
+func AbsGitPath(p string) (string, error) {
+	if filepath.IsAbs(p) {
+		return filepath.Clean(p), nil
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	if wd, err = filepath.EvalSymlinks(wd); err != nil {
+		return "", err
+	}
+	return filepath.Join(wd, p), nil
+}
+
+// BranchMergeBase returns the commit where HEAD forked from base. A base
+// that only exists as a remote-tracking branch (origin/<base>) is accepted.
+func BranchMergeBase(base string) (string, error) {
+	ref := base
+	if GitCommand("rev-parse", "--verify", "--quiet", ref+"^{commit}").Run() != nil {
+		ref = "origin/" + base
+		if GitCommand("rev-parse", "--verify", "--quiet", ref+"^{commit}").Run() != nil {
+			return "", fmt.Errorf("base branch %q not found (set ai-commit.baseBranch or pass --base)", base)
+		}
+	}
+	out, err := GitOutput("merge-base", ref, "HEAD")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// GitOutput runs git with args and returns its stdout.
+func GitOutput(args ...string) (string, error) {
+	cmd := GitCommand(args...)
+	var out bytes.Buffer
+	var errBuf bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &errBuf
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s failed: %v: %s", args[0], err, strings.TrimSpace(errBuf.String()))
+	}
+	return out.String(), nil
+}
+
+// getRepoRoot returns the top-level directory of the current work tree.
+func getRepoRoot() (string, error) {
+	cmd := GitCommand("rev-parse", "--show-toplevel")
+	var out bytes.Buffer
+	var errBuf bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &errBuf
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%w: %s", err, strings.TrimSpace(errBuf.String()))
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+// GitConfigGet returns the value of a git config key and whether it is set.
+func GitConfigGet(key string) (string, bool) {
+	// Uses the effective config (system + global + local), which is usually what you want.
+	// If the key is unset, git exits non-zero; we treat that as "not found".
+	cmd := GitCommand("config", "--get", key)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = io.Discard
+	if err := cmd.Run(); err != nil {
+		return "", false
+	}
+	return strings.TrimRight(out.String(), "\n"), true
+}
+
+// GitCommentChar returns the string Git uses to start comment lines in the
+// commit message file: core.commentString (Git 2.45+) or core.commentChar,
+// falling back to "#" when unset or set to "auto".
+func GitCommentChar() string {
+	for _, key := range []string{"core.commentString", "core.commentChar"} {
+		if v, ok := GitConfigGet(key); ok && v != "" && v != "auto" {
+			return v
+		}
+	}
+	return "#"
+}
+
+// GitConfigBool reads a boolean key using Git's own boolean rules
+// (true/yes/on/1, false/no/off/0). ok is false if the key is unset or invalid.
+func GitConfigBool(key string) (value bool, ok bool) {
+	cmd := GitCommand("config", "--type=bool", "--get", key)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = io.Discard
+	if err := cmd.Run(); err != nil {
+		return false, false
+	}
+	return strings.TrimSpace(out.String()) == "true", true
+}
+
+// gitConfigGetAll returns every value of a multi-valued key, in the order Git
+// reports them. An unset key yields nil.
+func gitConfigGetAll(key string) []string {
+	cmd := GitCommand("config", "--get-all", key)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = io.Discard
+	if err := cmd.Run(); err != nil {
+		return nil
+	}
+	return strings.Split(strings.TrimRight(out.String(), "\n"), "\n")
+}
+
+// gitConfigGetRegexp returns all (key, value) pairs whose key matches the
+// given regular expression, in the order Git reports them. Keys are returned
+// as Git prints them, i.e. with section and variable names lower-cased.
+func gitConfigGetRegexp(pattern string) [][2]string {
+	cmd := GitCommand("config", "--get-regexp", pattern)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = io.Discard
+	if err := cmd.Run(); err != nil {
+		return nil
+	}
+	var pairs [][2]string
+	for _, line := range strings.Split(strings.TrimRight(out.String(), "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(line, " ")
+		pairs = append(pairs, [2]string{key, value})
+	}
+	return pairs
+}
+
+// VerifyRevision reports an error unless rev names a commit.
+func VerifyRevision(rev string) error {
+	if err := GitCommand("rev-parse", "--verify", "--quiet", rev+"^{commit}").Run(); err != nil {
+		return fmt.Errorf("unknown revision %q: no such commit in this repository", rev)
+	}
+	return nil
+}
+
+// AmendBase returns what an amended commit should be diffed against: its
+// parent, or the empty tree when amending the root commit.
+func AmendBase() (string, error) {
+	if err := GitCommand("rev-parse", "--verify", "--quiet", "HEAD~1").Run(); err == nil {
+		return "HEAD~1", nil
+	}
+	// The empty tree's id depends on the repository's hash algorithm.
+	cmd := GitCommand("hash-object", "-t", "tree", "/dev/null")
+	var out bytes.Buffer
+	var errBuf bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &errBuf
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git hash-object failed: %v: %s", err, strings.TrimSpace(errBuf.String()))
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+// Limits on the commit history added to the prompt, so a large historyCount
+// or unusually long subjects can't blow up the request.
+const (
+	maxHistoryCount        = 50
+	maxHistorySubjectRunes = 100
+	maxHistoryBytes        = 2000
+)
+
+// withHistory fills cfg.History from the last cfg.HistoryCount commits
+// unless it is already set, so that commands that never build a prompt
+// don't run git log and one generation reads the history only once.
+func withHistory(cfg Config) Config {
+	if cfg.History != nil || cfg.HistoryCount <= 0 {
+		return cfg
+	}
+	if cfg.History = recentSubjects(cfg.HistoryCount); cfg.History == nil {
+		cfg.History = []string{} // no commits yet; don't ask again
+	}
+	return cfg
+}
+
+// recentSubjects returns up to n subject lines from git log, newest first,
+// for use as style examples. Errors (e.g. a repository with no commits yet)
+// yield nil.
+func recentSubjects(n int) []string {
+	n = min(n, maxHistoryCount)
+	cmd := GitCommand("log", "-n", strconv.Itoa(n), "--no-merges", "--pretty=%s")
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = io.Discard
+	if err := cmd.Run(); err != nil {
+		Debugf("history: git log failed: %v", err)
+		return nil
+	}
+
+	var subjects []string
+	size := 0
+	for _, line := range strings.Split(out.String(), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if r := []rune(line); len(r) > maxHistorySubjectRunes {
+			line = string(r[:maxHistorySubjectRunes]) + "..."
+		}
+		if size += len(line) + 1; size > maxHistoryBytes {
+			break
+		}
+		subjects = append(subjects, line)
+	}
+	return subjects
+}
@@ -0,0 +1,204 @@
+package aicommit
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestRepo creates an empty repository in a temporary directory, makes
+// it the working directory, and isolates git from the user's configuration
+// for the rest of the test.
+func newTestRepo(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	t.Chdir(dir)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	for _, v := range []string{"GIT_CONFIG_COUNT", "GIT_DIR", "GIT_WORK_TREE", "GIT_INDEX_FILE"} {
+		t.Setenv(v, "") // restores the variable after the test
+		os.Unsetenv(v)
+	}
+	for _, v := range []string{"GIT_AUTHOR_NAME", "GIT_COMMITTER_NAME"} {
+		t.Setenv(v, "Test")
+	}
+	for _, v := range []string{"GIT_AUTHOR_EMAIL", "GIT_COMMITTER_EMAIL"} {
+		t.Setenv(v, "test@example.com")
+	}
+	repoConfig = nil
+	activeProfile = ""
+	t.Cleanup(func() {
+		repoConfig = nil
+		activeProfile = ""
+	})
+	runGit(t, "init", "-q", "-b", "main")
+	return dir
+}
+
+// runGit runs git in the working directory and returns its output, failing
+// the test on error.
+func runGit(t *testing.T, args ...string) string {
+	t.Helper()
+	out, err := exec.Command("git", args...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return string(out)
+}
+
+// writeFile writes content to name, relative to the working directory.
+func writeFile(t *testing.T, name, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// gitWrapper writes a script that logs its arguments to a file and then runs
+// the real git, and returns the script and log paths. gitBinary is restored
+// after the test.
+func gitWrapper(t *testing.T) (script, log string) {
+	t.Helper()
+	real, err := exec.LookPath("git")
+	if err != nil {
+		t.Skip("git not found")
+	}
+	dir := t.TempDir()
+	script = filepath.Join(dir, "git-wrapper")
+	log = filepath.Join(dir, "calls.log")
+	content := "#!/bin/sh\necho \"$*\" >> " + log + "\nexec " + real + " \"$@\"\n"
+	if err := os.WriteFile(script, []byte(content), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	saved := gitBinary
+	t.Cleanup(func() { gitBinary = saved })
+	return script, log
+}
+
+func TestGitBinaryOverride(t *testing.T) {
+	newTestRepo(t)
+	writeFile(t, "README", "hello\n")
+	runGit(t, "add", "README")
+
+	for _, source := range []string{"AI_COMMIT_GIT", "ai-commit.gitBinary"} {
+		t.Run(source, func(t *testing.T) {
+			script, log := gitWrapper(t)
+			if source == "AI_COMMIT_GIT" {
+				t.Setenv("AI_COMMIT_GIT", script)
+			} else {
+				t.Setenv("AI_COMMIT_GIT", "")
+				runGit(t, "config", "ai-commit.gitBinary", script)
+				defer runGit(t, "config", "--unset", "ai-commit.gitBinary")
+			}
+			if err := FindGit(); err != nil {
+				t.Fatal(err)
+			}
+			if gitBinary != script {
+				t.Fatalf("gitBinary = %q, want %q", gitBinary, script)
+			}
+
+			if _, err := GitDir(); err != nil {
+				t.Fatal(err)
+			}
+			diff, err := StagedDiff(Config{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(diff, "+hello") {
+				t.Errorf("diff = %q", diff)
+			}
+			GitConfigGet("user.name")
+
+			data, err := os.ReadFile(log)
+			if err != nil {
+				t.Fatalf("wrapper was never run: %v", err)
+			}
+			for _, want := range []string{"rev-parse --git-dir", "diff --cached", "config --get user.name"} {
+				if !strings.Contains(string(data), want) {
+					t.Errorf("wrapper log lacks %q:\n%s", want, data)
+				}
+			}
+		})
+	}
+}
+
+func TestGitBinaryMissing(t *testing.T) {
+	gitWrapper(t) // restores gitBinary
+	t.Setenv("AI_COMMIT_GIT", filepath.Join(t.TempDir(), "no-such-git"))
+	if err := FindGit(); err == nil || !strings.HasPrefix(err.Error(), "AI_COMMIT_GIT: ") {
+		t.Errorf("FindGit error = %v, want one naming AI_COMMIT_GIT", err)
+	}
+}
+
+func TestGitDirFromEnvironment(t *testing.T) {
+	dir := newTestRepo(t) // isolates git; the repository itself is unused
+	store := filepath.Join(dir, "store.git")
+	work := filepath.Join(dir, "work")
+	if err := os.Mkdir(work, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, "--git-dir="+store, "--work-tree="+work, "init", "-q", "-b", "main")
+	t.Chdir(work)
+	writeFile(t, "notes.txt", "remember\n")
+
+	for name, gitDir := range map[string]string{"absolute": store, "relative": "../store.git"} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("GIT_DIR", gitDir)
+			t.Setenv("GIT_WORK_TREE", ".")
+			runGit(t, "add", "notes.txt")
+
+			got, err := GitDir()
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, _ := filepath.EvalSymlinks(store)
+			if got, _ = filepath.EvalSymlinks(got); got != want {
+				t.Errorf("GitDir = %q, want %q", got, want)
+			}
+			diff, err := StagedDiff(Config{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(diff, "+remember") {
+				t.Errorf("diff does not come from the GIT_DIR repository:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestAbsGitPath(t *testing.T) {
+	real := t.TempDir()
+	if err := os.Mkdir(filepath.Join(real, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(t.TempDir(), "link")
+	if err := os.Symlink(filepath.Join(real, "sub"), link); err != nil {
+		t.Skipf("symlinks unavailable: %v", err)
+	}
+	t.Chdir(link)
+	realResolved, _ := filepath.EvalSymlinks(real)
+
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"/abs/path/.git/", "/abs/path/.git"},
+		{".git", filepath.Join(realResolved, "sub", ".git")},
+		// Relative to the physical directory, not the symlink's parent.
+		{"../store.git", filepath.Join(realResolved, "store.git")},
+	}
+	for _, tt := range tests {
+		got, err := AbsGitPath(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("AbsGitPath(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
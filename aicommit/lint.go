@@ -0,0 +1,142 @@
+package aicommit
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// scissorsLine marks the start of the diff that `git commit --verbose` shows
+// below the message; Git discards it and everything after it.
+const scissorsLine = "------------------------ >8 ------------------------"
+
+// autoSubjectPrefixes start subjects that Git writes itself (merges, reverts,
+// fixup and squash commits). Lint leaves such messages alone.
+var autoSubjectPrefixes = []string{"Merge ", "Revert \"", "fixup! ", "squash! ", "amend! "}
+
+// nonImperativeExceptions end in "ed" or "ing" but are fine as the first
+// word of a subject.
+var nonImperativeExceptions = map[string]bool{
+	"bring": true, "embed": true, "exceed": true, "feed": true, "need": true,
+	"proceed": true, "seed": true, "shed": true, "speed": true, "spring": true,
+	"string": true, "succeed": true, "swing": true, "thing": true, "unembed": true,
+}
+
+// LintMessage checks an existing commit message against the conventions
+// BuildPrompt asks the model to follow: subject length, Conventional Commits
+// type and scope, imperative mood (best effort), a blank line between subject
+// and body, banned phrases, emoji and quoting. Comment lines starting with
+// commentChar and anything below a `git commit --verbose` scissors line are
+// ignored, as Git would. It returns one description per problem; merge,
+// revert, fixup and squash messages always pass.
+func LintMessage(cfg Config, msg, commentChar string) []string {
+	msg = stripComments(msg, commentChar)
+	if msg == "" {
+		return []string{"message is empty"}
+	}
+	for _, prefix := range autoSubjectPrefixes {
+		if strings.HasPrefix(msg, prefix) {
+			return nil
+		}
+	}
+
+	problems := validateCommitMessage(cfg, msg)
+	subject, rest, hasBody := strings.Cut(msg, "\n")
+	if hasBody && strings.TrimSpace(strings.SplitN(rest, "\n", 2)[0]) != "" {
+		problems = append(problems, "the subject must be followed by a blank line before the body")
+	}
+	if word := firstDescriptionWord(cfg, subject); word != "" && !isImperative(word) {
+		problems = append(problems, fmt.Sprintf("subject should use the imperative mood (%q reads like past tense or a gerund)", word))
+	}
+	if found := findBannedPhrases(msg, cfg.BannedPhrases); len(found) > 0 {
+		problems = append(problems, "message contains banned phrases: "+strings.Join(found, ", "))
+	}
+	if emojiProblem(cfg, msg) {
+		if cfg.Gitmoji && cfg.Style != "plain" {
+			problems = append(problems, "emoji are only allowed at the start of the subject")
+		} else {
+			problems = append(problems, "message contains emoji")
+		}
+	}
+	if quoteProblem(msg) {
+		problems = append(problems, "message contains quotation marks, backticks or backslashes")
+	}
+	return problems
+}
+
+// stripComments removes comment lines and the verbose diff, then trims msg.
+func stripComments(msg, commentChar string) string {
+	msg = strings.ReplaceAll(msg, "\r\n", "\n")
+	var kept []string
+	for _, line := range strings.Split(msg, "\n") {
+		if commentChar != "" && strings.HasPrefix(line, commentChar) {
+			if strings.TrimSpace(strings.TrimPrefix(line, commentChar)) == scissorsLine {
+				break
+			}
+			continue
+		}
+		kept = append(kept, strings.TrimRight(line, " \t"))
+	}
+	return strings.TrimSpace(strings.Join(kept, "\n"))
+}
+
+// firstDescriptionWord returns the first word of subject after any leading
+// emoji and, outside the plain style, the "type(scope): " prefix. It is
+// lower-cased for comparison.
+func firstDescriptionWord(cfg Config, subject string) string {
+	desc := strings.TrimLeftFunc(subject, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if cfg.Style != "plain" {
+		if m := subjectTypePattern.FindString(desc); m != "" {
+			desc = strings.TrimSpace(desc[len(m):])
+		}
+	}
+	word, _, _ := strings.Cut(desc, " ")
+	return strings.ToLower(strings.TrimRightFunc(word, unicode.IsPunct))
+}
+
+// isImperative is a best-effort check that word is not a past tense or
+// gerund ("added", "fixing"). Anything it cannot judge passes.
+func isImperative(word string) bool {
+	if len(word) < 5 || nonImperativeExceptions[word] {
+		return true
+	}
+	return !strings.HasSuffix(word, "ed") && !strings.HasSuffix(word, "ing")
+}
+
+// emojiProblem reports emoji in msg, other than the single leading emoji of
+// the subject when ai-commit.gitmoji is on.
+func emojiProblem(cfg Config, msg string) bool {
+	if cfg.Gitmoji && cfg.Style != "plain" {
+		if r, size := utf8.DecodeRuneInString(msg); isEmoji(r) {
+			msg = strings.TrimPrefix(msg[size:], "\uFE0F")
+		}
+	}
+	return strings.IndexFunc(msg, isEmoji) >= 0
+}
+
+// isEmoji reports whether r is in one of the common emoji blocks.
+func isEmoji(r rune) bool {
+	return r >= 0x1F000 && r <= 0x1FAFF || r >= 0x2600 && r <= 0x27BF || r == 0xFE0F
+}
+
+// quoteProblem reports double quotes, backticks and backslashes, and single
+// quotes that are not an apostrophe inside a word ("don't" is fine).
+func quoteProblem(msg string) bool {
+	if strings.ContainsAny(msg, "\"`\\") {
+		return true
+	}
+	for i := 0; i < len(msg); i++ {
+		if msg[i] != '\'' {
+			continue
+		}
+		before, _ := utf8.DecodeLastRuneInString(msg[:i])
+		after, _ := utf8.DecodeRuneInString(msg[i+1:])
+		if !unicode.IsLetter(before) || !unicode.IsLetter(after) {
+			return true
+		}
+	}
+	return false
+}
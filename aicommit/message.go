@@ -0,0 +1,478 @@
+package aicommit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// AddCoAuthors appends a Co-authored-by trailer for each ai-commit.coAuthors
+// entry. Trailers already present in msg or in existing (the current content
+// of the commit message file) are not repeated.
+func AddCoAuthors(cfg Config, msg, existing string) string {
+	return appendTrailers(msg, existing, "Co-authored-by", cfg.CoAuthors)
+}
+
+// appendTrailers appends "key: value" trailers to msg, separated from the body
+// by a blank line (or joining an existing trailer block). Trailers already in
+// msg or existing are skipped, compared case-insensitively.
+func appendTrailers(msg, existing, key string, values []string) string {
+	have := strings.ToLower(msg + "\n" + existing)
+	var add []string
+	for _, v := range values {
+		trailer := key + ": " + v
+		if !strings.Contains(have, strings.ToLower(trailer)) {
+			add = append(add, trailer)
+			have += "\n" + strings.ToLower(trailer)
+		}
+	}
+	if len(add) == 0 {
+		return msg
+	}
+
+	msg = strings.TrimRight(msg, "\n")
+	lines := strings.Split(msg, "\n")
+	if !isTrailerLine(lines[len(lines)-1]) || len(lines) == 1 {
+		msg += "\n"
+	}
+	return msg + "\n" + strings.Join(add, "\n") + "\n"
+}
+
+// MarkerKey is the trailer that marks a message as generated by
+// git-ai-commit, e.g. "X-AI-Commit: gpt-4o-mini; sha=0123456789ab". The sha
+// is a digest of the message it was appended to, so a later amend can tell
+// an untouched generated message from one the user has edited.
+const MarkerKey = "X-AI-Commit"
+
+// markerLine matches a marker trailer and captures its message digest.
+var markerLine = regexp.MustCompile(`^X-AI-Commit: .*; sha=([0-9a-f]{12})$`)
+
+// AddMarker appends the marker trailer for msg.
+func AddMarker(cfg Config, msg string) string {
+	value := cfg.Model + "; sha=" + messageDigest(msg)
+	return appendTrailers(msg, "", MarkerKey, []string{value})
+}
+
+// StripMarker removes every marker trailer from msg, along with the blank
+// lines left behind when the marker was the only trailer.
+func StripMarker(msg string) string {
+	var out []string
+	for _, line := range strings.Split(msg, "\n") {
+		if strings.HasPrefix(line, MarkerKey+":") {
+			continue
+		}
+		// Collapse the doubled blank line where the trailer block was.
+		if line == "" && len(out) > 0 && out[len(out)-1] == "" {
+			continue
+		}
+		out = append(out, line)
+	}
+	return strings.TrimRight(strings.Join(out, "\n"), "\n") + "\n"
+}
+
+// messageDigest hashes msg the way it survives Git's default cleanup:
+// surrounding whitespace and blank lines are ignored.
+func messageDigest(msg string) string {
+	var lines []string
+	for _, line := range strings.Split(msg, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	sum := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// IsUneditedMessage reports whether the non-comment part of a commit message
+// file carries a marker trailer whose digest still matches the rest of the
+// message, i.e. it is a generated message nobody has changed since.
+func IsUneditedMessage(commitMsg, commentChar string) bool {
+	var lines []string
+	digest := ""
+	for _, line := range strings.Split(commitMsg, "\n") {
+		if strings.HasPrefix(line, commentChar) {
+			continue
+		}
+		if m := markerLine.FindStringSubmatch(strings.TrimSpace(line)); m != nil {
+			digest = m[1]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return digest != "" && digest == messageDigest(strings.Join(lines, "\n"))
+}
+
+// HasMarker reports whether the non-comment part of a commit message file
+// carries a marker trailer, edited or not.
+func HasMarker(commitMsg, commentChar string) bool {
+	for _, line := range strings.Split(commitMsg, "\n") {
+		if !strings.HasPrefix(line, commentChar) && markerLine.MatchString(strings.TrimSpace(line)) {
+			return true
+		}
+	}
+	return false
+}
+
+// CommentLines returns only the comment lines of a commit message file.
+func CommentLines(commitMsg, commentChar string) string {
+	var out strings.Builder
+	for _, line := range strings.SplitAfter(commitMsg, "\n") {
+		if strings.HasPrefix(line, commentChar) {
+			out.WriteString(line)
+		}
+	}
+	return out.String()
+}
+
+// trailerLine matches a Git trailer such as "Co-authored-by: Name <email>".
+var trailerLine = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9-]*: \S`)
+
+// isTrailerLine reports whether line looks like a Git trailer.
+func isTrailerLine(line string) bool {
+	return trailerLine.MatchString(line)
+}
+
+// findBannedPhrases returns the phrases from banned that occur in msg,
+// compared case-insensitively.
+func findBannedPhrases(msg string, banned []string) []string {
+	lower := strings.ToLower(msg)
+	var found []string
+	for _, p := range banned {
+		if strings.Contains(lower, strings.ToLower(p)) {
+			found = append(found, p)
+		}
+	}
+	return found
+}
+
+// cleanCommitMessage applies SanitizeCommitMessage plus the configurable
+// post-processing steps to a raw model response.
+func cleanCommitMessage(cfg Config, s string) string {
+	s = SanitizeCommitMessage(s)
+	if cfg.StripDisclaimers {
+		s = StripTrailingDisclaimers(s, cfg.DisclaimerPatterns)
+	}
+	if cfg.FixImperative {
+		s = fixImperative(cfg, s)
+	}
+	if cfg.Gitmoji && cfg.Style != "plain" {
+		s = applyGitmoji(s)
+	}
+	if cfg.WrapBody {
+		s = wrapBody(s, cfg.WrapWidth)
+	}
+	return s
+}
+
+// bulletPrefix matches the marker of a bullet or numbered list item, e.g.
+// "- ", "  * " or "2. ".
+var bulletPrefix = regexp.MustCompile(`^\s*(?:[-*+]|\d+[.)])\s+`)
+
+// wrapBody hard-wraps the lines after the subject at width columns. Wrapped
+// bullet items continue under the first character of their text; blank
+// lines, trailers and words longer than width are left alone.
+func wrapBody(msg string, width int) string {
+	lines := strings.Split(msg, "\n")
+	out := []string{lines[0]}
+	for _, line := range lines[1:] {
+		if utf8.RuneCountInString(line) <= width || isTrailerLine(line) {
+			out = append(out, line)
+			continue
+		}
+		prefix := bulletPrefix.FindString(line)
+		indent := strings.Repeat(" ", utf8.RuneCountInString(prefix))
+		if prefix == "" {
+			prefix = line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+			indent = prefix
+		}
+		cur := prefix
+		for _, word := range strings.Fields(line[len(prefix):]) {
+			if cur != prefix && cur != indent && utf8.RuneCountInString(cur)+1+utf8.RuneCountInString(word) > width {
+				out = append(out, cur)
+				cur = indent
+			}
+			if cur == prefix || cur == indent {
+				cur += word
+			} else {
+				cur += " " + word
+			}
+		}
+		out = append(out, cur)
+	}
+	return strings.Join(out, "\n")
+}
+
+// subjectTypePattern matches a Conventional Commits subject prefix such as
+// "feat:", "fix(api):" or "refactor!:" and captures the type.
+var subjectTypePattern = regexp.MustCompile(`^([A-Za-z]+)(\([^)]*\))?!?:`)
+
+// applyGitmoji normalises the subject's leading emoji to the one mapped to its
+// Conventional Commits type, replacing whatever emoji (if any) the model chose.
+// Subjects without a recognised type are left untouched.
+func applyGitmoji(msg string) string {
+	subject, rest, hasRest := strings.Cut(msg, "\n")
+	bare := strings.TrimLeftFunc(subject, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	m := subjectTypePattern.FindStringSubmatch(bare)
+	if m == nil {
+		return msg
+	}
+	for _, t := range conventionalTypes {
+		if strings.EqualFold(t.Name, m[1]) {
+			subject = t.Gitmoji + " " + bare
+			break
+		}
+	}
+	if hasRest {
+		return subject + "\n" + rest
+	}
+	return subject
+}
+
+// imperativeForms maps the imperative of verbs that commonly start a
+// subject to their past tense, gerund and third-person forms.
+var imperativeForms = map[string]string{
+	"add":       "added adding adds",
+	"adjust":    "adjusted adjusting adjusts",
+	"allow":     "allowed allowing allows",
+	"avoid":     "avoided avoiding avoids",
+	"build":     "built building builds",
+	"bump":      "bumped bumping bumps",
+	"change":    "changed changing",
+	"clarify":   "clarified clarifying clarifies",
+	"clean":     "cleaned cleaning cleans",
+	"convert":   "converted converting converts",
+	"correct":   "corrected correcting corrects",
+	"create":    "created creating creates",
+	"delete":    "deleted deleting deletes",
+	"deprecate": "deprecated deprecating deprecates",
+	"disable":   "disabled disabling disables",
+	"document":  "documented documenting documents",
+	"drop":      "dropped dropping drops",
+	"enable":    "enabled enabling enables",
+	"ensure":    "ensured ensuring ensures",
+	"expose":    "exposed exposing exposes",
+	"extract":   "extracted extracting extracts",
+	"fix":       "fixed fixing fixes",
+	"handle":    "handled handling handles",
+	"implement": "implemented implementing implements",
+	"improve":   "improved improving improves",
+	"introduce": "introduced introducing introduces",
+	"make":      "made making makes",
+	"merge":     "merged merging merges",
+	"migrate":   "migrated migrating migrates",
+	"move":      "moved moving moves",
+	"optimize":  "optimized optimizing optimizes",
+	"prevent":   "prevented preventing prevents",
+	"reduce":    "reduced reducing reduces",
+	"refactor":  "refactored refactoring refactors",
+	"remove":    "removed removing removes",
+	"rename":    "renamed renaming renames",
+	"replace":   "replaced replacing replaces",
+	"restore":   "restored restoring restores",
+	"revert":    "reverted reverting reverts",
+	"simplify":  "simplified simplifying simplifies",
+	"split":     "splitting splits",
+	"support":   "supported supporting supports",
+	"switch":    "switched switching switches",
+	"update":    "updated updating updates",
+	"upgrade":   "upgraded upgrading upgrades",
+	"use":       "used using uses",
+	"validate":  "validated validating validates",
+	"write":     "wrote written writing writes",
+}
+
+// imperativeOf is imperativeForms inverted: each inflected form mapped to
+// its imperative.
+var imperativeOf = func() map[string]string {
+	m := map[string]string{}
+	for verb, forms := range imperativeForms {
+		for _, form := range strings.Fields(forms) {
+			m[form] = verb
+		}
+	}
+	return m
+}()
+
+// fixImperative rewrites the first word of the subject's description, after
+// any leading emoji and, outside the plain style, the "type(scope): "
+// prefix, to the imperative when it is a known inflected verb ("Added" →
+// "Add", "fixing" → "fix"). The word's leading capital is kept. Nothing else
+// in the message is touched.
+func fixImperative(cfg Config, msg string) string {
+	subject, rest, hasRest := strings.Cut(msg, "\n")
+	start := len(subject) - len(strings.TrimLeftFunc(subject, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}))
+	if cfg.Style != "plain" {
+		if m := subjectTypePattern.FindString(subject[start:]); m != "" {
+			start += len(m)
+			start += len(subject[start:]) - len(strings.TrimLeft(subject[start:], " "))
+		}
+	}
+	end := start + len(subject[start:]) - len(strings.TrimLeftFunc(subject[start:], unicode.IsLetter))
+	word := subject[start:end]
+	verb, ok := imperativeOf[strings.ToLower(word)]
+	if !ok {
+		return msg
+	}
+	if r, _ := utf8.DecodeRuneInString(word); unicode.IsUpper(r) {
+		verb = strings.ToUpper(verb[:1]) + verb[1:]
+	}
+	subject = subject[:start] + verb + subject[end:]
+	if hasRest {
+		return subject + "\n" + rest
+	}
+	return subject
+}
+
+// defaultDisclaimerPatterns match the opening of trailing paragraphs that some
+// models append after an otherwise good commit message. They are matched
+// case-insensitively against the start of a paragraph. "Note:" is not among
+// them: a closing note is often real content, such as a migration step.
+var defaultDisclaimerPatterns = []string{
+	`^disclaimer\b`,
+	`^as an ai\b`,
+	`^i (cannot|can't|can not|am unable to|do not have|don't have)\b`,
+	`^(i )?hope this helps\b`,
+	`^let me know if\b`,
+	`^feel free to\b`,
+	`^this (commit )?message (was|is) (generated|based)\b`,
+}
+
+// compileDisclaimerPatterns compiles the default patterns plus any extra
+// user-supplied ones, case-insensitively.
+func compileDisclaimerPatterns(extra []string) ([]*regexp.Regexp, error) {
+	var res []*regexp.Regexp
+	for _, p := range append(append([]string{}, defaultDisclaimerPatterns...), extra...) {
+		re, err := regexp.Compile("(?i)" + p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid disclaimer pattern %q: %w", p, err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+// StripTrailingDisclaimers removes trailing paragraphs (blocks separated by a
+// blank line) whose text matches one of patterns. Only paragraphs at the end
+// of the message are removed, and never the first paragraph (the subject).
+func StripTrailingDisclaimers(s string, patterns []*regexp.Regexp) string {
+	paras := strings.Split(strings.TrimRight(s, "\n"), "\n\n")
+	for len(paras) > 1 {
+		last := strings.TrimSpace(paras[len(paras)-1])
+		matched := last == ""
+		for _, re := range patterns {
+			if re.MatchString(last) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			break
+		}
+		paras = paras[:len(paras)-1]
+	}
+	out := strings.TrimRight(strings.Join(paras, "\n\n"), "\n")
+	if out != "" {
+		out += "\n"
+	}
+	return out
+}
+
+// preambleLine matches a whole first line of conversational filler that some
+// models emit before the message despite the prompt, such as "Sure! Here's
+// a commit message for these changes:" or a bare "Commit message:" label.
+var preambleLine = regexp.MustCompile(`(?i)^(?:` +
+	`(?:sure|certainly|of course|absolutely|okay)[,!.].*` +
+	`|(?:here(?:'s| is| are)|below is)\b.*:` +
+	`|\**(?:suggested |proposed |generated )?commit message\**:?\**` +
+	`)$`)
+
+// commitLabel matches a "Commit message:" label followed by the subject on
+// the same line; the subject is kept.
+var commitLabel = regexp.MustCompile(`(?i)^\**(?:suggested |proposed |generated )?commit message\**:\**\s+(\S.*)$`)
+
+// fenceTag matches the optional language tag after an opening code fence.
+var fenceTag = regexp.MustCompile(`^[A-Za-z0-9_+-]*$`)
+
+// stripPreamble removes leading preamble lines from s. It only drops lines
+// that are followed by more content, so a message is never emptied.
+func stripPreamble(s string) string {
+	for {
+		first, rest, found := strings.Cut(s, "\n")
+		first = strings.TrimSpace(first)
+		if m := commitLabel.FindStringSubmatch(first); m != nil {
+			return strings.TrimSpace(m[1] + "\n" + rest)
+		}
+		if !found || strings.TrimSpace(rest) == "" || !preambleLine.MatchString(first) {
+			return s
+		}
+		s = strings.TrimSpace(rest)
+	}
+}
+
+// SanitizeCommitMessage normalises a raw model response into a commit
+// message: CRLF becomes LF, preambles and code fences are removed, and the
+// result ends with a single newline.
+func SanitizeCommitMessage(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.TrimSpace(s)
+	s = stripPreamble(s)
+
+	// Some models wrap the message in a code fence, optionally with a
+	// language tag; anything after the closing fence is commentary.
+	if rest, ok := strings.CutPrefix(s, "```"); ok {
+		if tag, body, found := strings.Cut(rest, "\n"); found && fenceTag.MatchString(tag) {
+			rest = body
+		}
+		if end := strings.Index(rest, "```"); end >= 0 {
+			rest = rest[:end]
+		}
+		s = strings.TrimSpace(rest)
+	} else {
+		// A lone closing fence with no opening one.
+		s = strings.TrimSpace(strings.TrimSuffix(s, "```"))
+	}
+
+	// Ensure it ends with a newline (Git is fine either way, but this is tidy).
+	if s != "" && !strings.HasSuffix(s, "\n") {
+		s += "\n"
+	}
+	return s
+}
+
+// HasNonCommentContent reports whether commitMsg contains any line that is
+// neither blank nor a comment starting with commentChar.
+func HasNonCommentContent(commitMsg, commentChar string) bool {
+	commitMsg = strings.ReplaceAll(commitMsg, "\r\n", "\n")
+	for _, line := range strings.Split(commitMsg, "\n") {
+		trim := strings.TrimSpace(line)
+		if trim == "" {
+			continue
+		}
+		if strings.HasPrefix(trim, commentChar) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// EscapeCommentLines indents any line of msg that would otherwise be read as a
+// comment by Git (i.e. starts with commentChar) by a single space, so the line
+// survives Git's comment stripping.
+func EscapeCommentLines(msg, commentChar string) string {
+	lines := strings.Split(msg, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, commentChar) {
+			lines[i] = " " + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,290 @@
+package aicommit
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSanitizeCommitMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"empty", "", ""},
+		{"whitespace only", " \n\t\n", ""},
+		{"adds trailing newline", "fix: typo", "fix: typo\n"},
+		{"trims surrounding space", "\n\n  fix: typo  \n\n", "fix: typo\n"},
+		{"crlf", "fix: typo\r\n\r\n- detail\r\n", "fix: typo\n\n- detail\n"},
+		{"fence", "```\nfix: typo\n```", "fix: typo\n"},
+		{"fence with tag", "```text\nfix: typo\n\n- detail\n```", "fix: typo\n\n- detail\n"},
+		{"commentary after fence", "```\nfix: typo\n```\nLet me know if you want changes.", "fix: typo\n"},
+		{"unclosed fence", "```\nfix: typo", "fix: typo\n"},
+		{"lone trailing fence", "feat: x\n\n- y\n```", "feat: x\n\n- y\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SanitizeCommitMessage(tt.in); got != tt.want {
+				t.Errorf("SanitizeCommitMessage(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddCoAuthors(t *testing.T) {
+	cfg := Config{CoAuthors: []string{"Ann <ann@example.com>", "Bob <bob@example.com>"}}
+	tests := []struct {
+		name     string
+		msg      string
+		existing string
+		want     string
+	}{
+		{
+			"subject only",
+			"fix: typo\n", "",
+			"fix: typo\n\nCo-authored-by: Ann <ann@example.com>\nCo-authored-by: Bob <bob@example.com>\n",
+		},
+		{
+			"joins trailer block",
+			"fix: typo\n\nRefs: #12\n", "",
+			"fix: typo\n\nRefs: #12\nCo-authored-by: Ann <ann@example.com>\nCo-authored-by: Bob <bob@example.com>\n",
+		},
+		{
+			"body ends in prose",
+			"fix: typo\n\n- correct the spelling\n", "",
+			"fix: typo\n\n- correct the spelling\n\nCo-authored-by: Ann <ann@example.com>\nCo-authored-by: Bob <bob@example.com>\n",
+		},
+		{
+			"skips trailer already in message",
+			"fix: typo\n\nco-authored-by: ann <ann@example.com>\n", "",
+			"fix: typo\n\nco-authored-by: ann <ann@example.com>\nCo-authored-by: Bob <bob@example.com>\n",
+		},
+		{
+			"skips trailer already in file",
+			"fix: typo\n", "# comment\nCo-authored-by: Ann <ann@example.com>\nCo-authored-by: Bob <bob@example.com>\n",
+			"fix: typo\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AddCoAuthors(cfg, tt.msg, tt.existing); got != tt.want {
+				t.Errorf("AddCoAuthors(%q) = %q, want %q", tt.msg, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarker(t *testing.T) {
+	cfg := Config{Model: "gpt-4o-mini"}
+	msg := "feat: add login\n\n- add the form\n"
+	marked := AddMarker(cfg, msg)
+
+	if !strings.HasPrefix(marked, msg+"\n"+MarkerKey+": gpt-4o-mini; sha=") {
+		t.Fatalf("AddMarker = %q", marked)
+	}
+	if got := StripMarker(marked); got != msg {
+		t.Errorf("StripMarker(AddMarker(msg)) = %q, want %q", got, msg)
+	}
+
+	tests := []struct {
+		name       string
+		file       string
+		hasMarker  bool
+		isUnedited bool
+	}{
+		{"unedited", marked, true, true},
+		{"with git comments", marked + "# Please enter the commit message.\n# On branch main\n", true, true},
+		{"whitespace changes only", "\n" + strings.ReplaceAll(marked, "\n\n", "\n\n\n"), true, true},
+		{"edited subject", strings.Replace(marked, "add login", "add sign-in", 1), true, false},
+		{"edited body", strings.Replace(marked, "the form", "a form", 1), true, false},
+		{"no marker", msg, false, false},
+		{"commented-out marker", msg + "\n# " + strings.TrimPrefix(marked, msg+"\n"), false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HasMarker(tt.file, "#"); got != tt.hasMarker {
+				t.Errorf("HasMarker = %v, want %v", got, tt.hasMarker)
+			}
+			if got := IsUneditedMessage(tt.file, "#"); got != tt.isUnedited {
+				t.Errorf("IsUneditedMessage = %v, want %v", got, tt.isUnedited)
+			}
+		})
+	}
+}
+
+func TestStripMarker(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"only trailer", "fix: typo\n\nX-AI-Commit: m; sha=0123456789ab\n", "fix: typo\n"},
+		{"keeps other trailers", "fix: typo\n\nRefs: #1\nX-AI-Commit: m; sha=0123456789ab\n", "fix: typo\n\nRefs: #1\n"},
+		{"no trailer", "fix: typo\n\n- detail\n", "fix: typo\n\n- detail\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := StripMarker(tt.in); got != tt.want {
+				t.Errorf("StripMarker(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripTrailingDisclaimers(t *testing.T) {
+	patterns, err := compileDisclaimerPatterns([]string{`^generated by`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"no disclaimer", "feat: add cache\n\n- add a TTL\n", "feat: add cache\n\n- add a TTL\n"},
+		{"hope this helps", "feat: add cache\n\n- add a TTL\n\nI hope this helps!\n", "feat: add cache\n\n- add a TTL\n"},
+		{"several trailing", "fix: typo\n\nAs an AI, I cannot run the tests.\n\nLet me know if you need changes.", "fix: typo\n"},
+		{"case-insensitive", "fix: typo\n\nFEEL FREE TO adjust the wording.\n", "fix: typo\n"},
+		{"extra pattern", "fix: typo\n\nGenerated by a local model.\n", "fix: typo\n"},
+		{"note kept", "feat: add orders table\n\n- add the schema\n\nNote: requires a DB migration.\n", "feat: add orders table\n\n- add the schema\n\nNote: requires a DB migration.\n"},
+		{"please note kept", "fix: typo\n\nPlease note that the old flag still works.\n", "fix: typo\n\nPlease note that the old flag still works.\n"},
+		{"only at the end", "fix: typo\n\nI hope this helps.\n\n- real detail\n", "fix: typo\n\nI hope this helps.\n\n- real detail\n"},
+		{"subject kept", "I hope this helps\n", "I hope this helps\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := StripTrailingDisclaimers(tt.in, patterns); got != tt.want {
+				t.Errorf("StripTrailingDisclaimers(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFixImperative(t *testing.T) {
+	tests := []struct {
+		name  string
+		style string
+		in    string
+		want  string
+	}{
+		{"past tense", "plain", "Added retry logic\n", "Add retry logic\n"},
+		{"irregular past tense", "plain", "Wrote the migration guide\n", "Write the migration guide\n"},
+		{"gerund", "plain", "fixing flaky test\n", "fix flaky test\n"},
+		{"third person", "plain", "Updates the README\n", "Update the README\n"},
+		{"type prefix", "conventional", "feat: added OAuth2 login\n", "feat: add OAuth2 login\n"},
+		{"type and scope", "conventional", "fix(api): handles nil body\n", "fix(api): handle nil body\n"},
+		{"breaking change", "conventional", "feat(cli)!: removed --legacy\n", "feat(cli)!: remove --legacy\n"},
+		{"emoji and type", "conventional", "✨ feat(auth): Introduced SSO\n", "✨ feat(auth): Introduce SSO\n"},
+		{"body untouched", "plain", "Added cache\n\n- Added a TTL\n- fixed eviction\n", "Add cache\n\n- Added a TTL\n- fixed eviction\n"},
+		{"already imperative", "plain", "Add retry logic\n", "Add retry logic\n"},
+		{"unknown word", "plain", "Bootstrapped the project\n", "Bootstrapped the project\n"},
+		{"noun that looks like a verb", "plain", "Changes to the parser\n", "Changes to the parser\n"},
+		{"verb not first", "plain", "README updated\n", "README updated\n"},
+		{"type is not rewritten in plain style", "plain", "docs: updated guide\n", "docs: updated guide\n"},
+		{"word prefix only", "plain", "Addressed review comments\n", "Addressed review comments\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fixImperative(Config{Style: tt.style}, tt.in); got != tt.want {
+				t.Errorf("fixImperative(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWrapBody(t *testing.T) {
+	tests := []struct {
+		name  string
+		in    string
+		width int
+		want  string
+	}{
+		{
+			"short lines untouched",
+			"fix: typo\n\n- correct the spelling\n",
+			30,
+			"fix: typo\n\n- correct the spelling\n",
+		},
+		{
+			"long subject untouched",
+			"feat: a subject that is much longer than the width\n",
+			20,
+			"feat: a subject that is much longer than the width\n",
+		},
+		{
+			"dash bullet",
+			"feat: x\n\n- retry the request once when the server closes the connection\n",
+			30,
+			"feat: x\n\n- retry the request once when\n  the server closes the\n  connection\n",
+		},
+		{
+			"star bullet, indented",
+			"feat: x\n\n  * retry the request once when the server closes\n",
+			30,
+			"feat: x\n\n  * retry the request once\n    when the server closes\n",
+		},
+		{
+			"numbered item",
+			"feat: x\n\n10. retry the request once when the server closes\n",
+			30,
+			"feat: x\n\n10. retry the request once\n    when the server closes\n",
+		},
+		{
+			"paragraph",
+			"feat: x\n\nRetry the request once when the server closes the connection.\n",
+			30,
+			"feat: x\n\nRetry the request once when\nthe server closes the\nconnection.\n",
+		},
+		{
+			"long word kept whole",
+			"feat: x\n\n- see https://example.com/a/very/long/path/that/cannot/break\n",
+			30,
+			"feat: x\n\n- see\n  https://example.com/a/very/long/path/that/cannot/break\n",
+		},
+		{
+			"trailer untouched",
+			"feat: x\n\nCo-authored-by: Someone With A Long Name <someone@example.com>\n",
+			30,
+			"feat: x\n\nCo-authored-by: Someone With A Long Name <someone@example.com>\n",
+		},
+		{
+			"multibyte counted as runes",
+			"feat: x\n\n- überprüfe die Größe\n",
+			22,
+			"feat: x\n\n- überprüfe die Größe\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := wrapBody(tt.in, tt.width); got != tt.want {
+				t.Errorf("wrapBody(%q, %d) =\n%s\nwant\n%s", tt.in, tt.width, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripPreamble(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"sure", "Sure! Here's a commit message for these changes:\n\nfix: typo\n", "fix: typo\n"},
+		{"here is", "Here is the commit message:\nfix: typo\n\n- detail\n", "fix: typo\n\n- detail\n"},
+		{"certainly then label", "Certainly.\nCommit message:\nfix: typo\n", "fix: typo\n"},
+		{"bold label", "**Commit message:**\n\nfix: typo\n", "fix: typo\n"},
+		{"label on the same line", "Suggested commit message: fix: typo\n\n- detail\n", "fix: typo\n\n- detail\n"},
+		{"preamble before fence", "Here's the message:\n```\nfix: typo\n```\n", "fix: typo\n"},
+		{"no preamble", "fix: typo\n\n- detail\n", "fix: typo\n\n- detail\n"},
+		{"preamble only", "Sure! Here is the message:\n", "Sure! Here is the message:\n"},
+		{"subject starting with Sure kept", "Surely handle nil body\n", "Surely handle nil body\n"},
+		{"subject ending in colon kept", "docs: explain the flags:\n", "docs: explain the flags:\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SanitizeCommitMessage(tt.in); got != tt.want {
+				t.Errorf("SanitizeCommitMessage(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package aicommit
+
+import (
+	"fmt"
+	"strings"
+)
+
+// buildBothPrompt extends the commit prompt to request both a short
+// (subject-only) and a long (full) message as one JSON object.
+func buildBothPrompt(cfg Config, diff string) string {
+	return BuildPrompt(cfg, diff) + `
+
+Output format override: instead of plain text, respond with exactly one JSON object and nothing else:
+{"short": "<subject line only>", "long": "<full commit message: subject, blank line, bullet points>"}
+Use \n for line breaks inside the JSON strings. The quotation mark rule does not apply to the JSON syntax itself.`
+}
+
+// conventionalTypes lists the Conventional Commits types the prompt offers,
+// in the order they are presented to the model.
+// Gitmoji is the emoji used for the type when ai-commit.gitmoji is enabled.
+var conventionalTypes = []struct {
+	Name, Description, Gitmoji string
+}{
+	{"feat", "a new feature", "✨"},
+	{"fix", "a bug fix", "🐛"},
+	{"docs", "documentation changes only", "📝"},
+	{"style", "formatting, whitespace — no logic change", "🎨"},
+	{"refactor", "code restructured without adding features or fixing bugs", "♻️"},
+	{"perf", "performance improvement", "⚡️"},
+	{"test", "adding or updating tests", "✅"},
+	{"chore", "build process, tooling, dependency updates, CI config", "🔧"},
+}
+
+// languageNames maps common ISO 639-1 codes to the language name used in the
+// prompt. Values not listed here are passed to the model as given.
+var languageNames = map[string]string{
+	"de": "German",
+	"es": "Spanish",
+	"fr": "French",
+	"it": "Italian",
+	"ja": "Japanese",
+	"ko": "Korean",
+	"nl": "Dutch",
+	"pl": "Polish",
+	"pt": "Portuguese",
+	"ru": "Russian",
+	"sv": "Swedish",
+	"tr": "Turkish",
+	"uk": "Ukrainian",
+	"zh": "Chinese",
+}
+
+// languageName returns the language to request in the prompt, or "" for the
+// default (English).
+func languageName(lang string) string {
+	lang = strings.TrimSpace(lang)
+	if lang == "" || strings.EqualFold(lang, "en") || strings.EqualFold(lang, "english") {
+		return ""
+	}
+	if name, ok := languageNames[strings.ToLower(lang)]; ok {
+		return name
+	}
+	return lang
+}
+
+// BuildPrompt returns the user prompt asking for a commit message for diff.
+// With cfg.HistoryCount set and no cfg.History, the recent subjects are read
+// from git log.
+func BuildPrompt(cfg Config, diff string) string {
+	cfg = withHistory(cfg)
+	// Keep prompt simple and instruction-focused.
+	var b strings.Builder
+	b.WriteString("You are an expert software engineer. Write a Git commit message for the following staged diff.\n\n")
+	b.WriteString("Requirements:\n")
+	b.WriteString("- Output plain text only.\n")
+
+	if cfg.Style == "plain" {
+		fmt.Fprintf(&b, "- First line: a concise, clear subject, max %d characters.\n", cfg.SubjectMaxLen)
+		b.WriteString("  Do not prefix the subject with a type or scope label.\n")
+		b.WriteString("  Write the subject in imperative mood, e.g. \"Add retry logic\" not \"Added retry logic\".\n")
+	} else {
+		fmt.Fprintf(&b, "- First line: a concise subject following the Conventional Commits format, max %d characters.\n", cfg.SubjectMaxLen)
+		b.WriteString("  The subject must start with one of these types followed by a colon and a space:\n")
+		for _, t := range conventionalTypes {
+			if cfg.Gitmoji {
+				fmt.Fprintf(&b, "    %s %-9s %s\n", t.Gitmoji, t.Name+":", t.Description)
+			} else {
+				fmt.Fprintf(&b, "    %-9s %s\n", t.Name+":", t.Description)
+			}
+		}
+		if len(cfg.ExtraTypes) > 0 {
+			fmt.Fprintf(&b, "  This project also allows: %s.\n", strings.Join(cfg.ExtraTypes, ", "))
+		}
+		if len(cfg.Scopes) > 0 {
+			fmt.Fprintf(&b, "  Use a scope in parentheses when it helps clarity. Choose the scope from this list: %s.\n", strings.Join(cfg.Scopes, ", "))
+		} else {
+			b.WriteString("  Use a scope in parentheses when it helps clarity, e.g. \"feat(auth): add OAuth2 login\".\n")
+		}
+		b.WriteString("  Write the description in imperative mood, e.g. \"feat: add retry logic\" not \"feat: added retry logic\".\n")
+		if cfg.Gitmoji {
+			b.WriteString("  Start the subject with the emoji listed for its type, then a space, e.g. \"✨ feat(auth): add OAuth2 login\".\n")
+		}
+	}
+
+	if cfg.IncludeBody {
+		b.WriteString("- Then a blank line.\n")
+		b.WriteString("- Then 3-7 bullet points (\"- \") summarizing key changes.\n")
+		b.WriteString("- Mention user-visible behavior changes and important refactors.\n")
+	} else {
+		b.WriteString("- Output only the subject line: no body, no bullet points.\n")
+	}
+
+	if lang := languageName(cfg.Language); lang != "" {
+		if cfg.Style == "plain" {
+			fmt.Fprintf(&b, "- Write the subject and body in %s.\n", lang)
+		} else {
+			fmt.Fprintf(&b, "- Write the subject description and body in %s, but keep the type prefix (feat, fix, ...) and scope in English.\n", lang)
+		}
+	}
+	if len(cfg.History) > 0 {
+		b.WriteString("- Match the voice and conventions of these recent commit subjects from this repository (examples only, do not copy them):\n")
+		for _, subject := range cfg.History {
+			fmt.Fprintf(&b, "    %s\n", subject)
+		}
+	}
+	b.WriteString("- Do not include code fences.\n")
+	if cfg.Gitmoji && cfg.Style != "plain" {
+		b.WriteString("- Do not use emoji anywhere except the single leading emoji of the subject.\n")
+	} else {
+		b.WriteString("- Do not use emoji anywhere in the output.\n")
+	}
+	b.WriteString("- Do not use any quotation marks (single, double, or backticks) in the output.\n")
+	b.WriteString("- Do not use backslashes or any other escape characters in the output.\n")
+	b.WriteString("- The output must be safe to copy and paste directly into a terminal without any shell interpretation issues.\n")
+	b.WriteString("\nStaged diff:\n")
+	b.WriteString(diff)
+	return strings.TrimSpace(b.String())
+}
+
+// BuildPRPrompt asks for a pull request description from the branch's commit
+// subjects and its diff against the merge base.
+func BuildPRPrompt(cfg Config, commits, diff string) string {
+	var b strings.Builder
+	b.WriteString("You are an expert software engineer. Write a pull request description for the following branch.\n\n")
+	b.WriteString("Requirements:\n")
+	b.WriteString("- Output GitHub-flavored Markdown with exactly these sections, in this order:\n")
+	b.WriteString("    ## Title      one line, max 72 characters, describing the change as a whole\n")
+	b.WriteString("    ## Summary    a short paragraph on what changed and why, then bullet points for the key changes\n")
+	b.WriteString("    ## Testing    how the change can be verified; say so plainly if the diff shows no tests\n")
+	b.WriteString("- Describe the branch as a whole rather than listing every commit.\n")
+	b.WriteString("- Mention user-visible behavior changes, breaking changes and important refactors.\n")
+	if lang := languageName(cfg.Language); lang != "" {
+		fmt.Fprintf(&b, "- Write the description in %s, but keep the section headings in English.\n", lang)
+	}
+	b.WriteString("- Do not wrap the output in code fences.\n")
+	b.WriteString("- Do not use emoji anywhere in the output.\n")
+	b.WriteString("\nCommits on the branch (oldest first):\n")
+	b.WriteString(commits)
+	b.WriteString("\n\nDiff against the base branch:\n")
+	b.WriteString(diff)
+	return strings.TrimSpace(b.String())
+}
+
+// BuildNotesPrompt asks for release notes for from..to from the output of
+// RangeSummary.
+func BuildNotesPrompt(cfg Config, from, to, changes string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "You are an expert software engineer. Write release notes for the changes from %s to %s.\n\n", from, to)
+	b.WriteString("Requirements:\n")
+	b.WriteString("- Output Markdown grouped under these headings, in this order: ## Features, ## Fixes, ## Other.\n")
+	b.WriteString("- Omit a heading that would have no entries.\n")
+	b.WriteString("- One bullet point (\"- \") per user-relevant change, written for users of the project rather than its developers.\n")
+	b.WriteString("- Merge related commits into a single entry, and leave out purely internal changes such as CI tweaks unless they matter to users.\n")
+	b.WriteString("- Call out breaking changes explicitly.\n")
+	if lang := languageName(cfg.Language); lang != "" {
+		fmt.Fprintf(&b, "- Write the notes in %s, but keep the headings in English.\n", lang)
+	}
+	b.WriteString("- Do not wrap the output in code fences.\n")
+	b.WriteString("- Do not use emoji anywhere in the output.\n")
+	b.WriteString("\n")
+	b.WriteString(changes)
+	return strings.TrimSpace(b.String())
+}
+
+// defaultSystemPrompt is the system message sent with every request unless
+// ai-commit.systemPrompt replaces it.
+const defaultSystemPrompt = "You write concise, high-signal Git commit messages."
@@ -0,0 +1,125 @@
+package aicommit
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuildPrompt(t *testing.T) {
+	const diff = "diff --git a/x.go b/x.go\n+package x\n"
+	tests := []struct {
+		name    string
+		cfg     Config
+		want    []string
+		notWant []string
+	}{
+		{
+			name: "conventional",
+			cfg:  Config{Style: "conventional", SubjectMaxLen: 72, IncludeBody: true},
+			want: []string{
+				"following the Conventional Commits format, max 72 characters",
+				"feat:",
+				"fix:",
+				"e.g. \"feat(auth): add OAuth2 login\"",
+				"3-7 bullet points",
+			},
+			notWant: []string{"Do not prefix the subject", "Output only the subject line"},
+		},
+		{
+			name:    "plain",
+			cfg:     Config{Style: "plain", SubjectMaxLen: 50, IncludeBody: true},
+			want:    []string{"concise, clear subject, max 50 characters", "Do not prefix the subject with a type or scope label"},
+			notWant: []string{"Conventional Commits", "feat:"},
+		},
+		{
+			name:    "subject only",
+			cfg:     Config{Style: "conventional", SubjectMaxLen: 72},
+			want:    []string{"Output only the subject line: no body, no bullet points."},
+			notWant: []string{"bullet points (\"- \")"},
+		},
+		{
+			name: "scopes and extra types",
+			cfg:  Config{Style: "conventional", SubjectMaxLen: 72, Scopes: []string{"api", "cli"}, ExtraTypes: []string{"wip"}},
+			want: []string{"Choose the scope from this list: api, cli.", "This project also allows: wip."},
+		},
+		{
+			name:    "gitmoji",
+			cfg:     Config{Style: "conventional", SubjectMaxLen: 72, Gitmoji: true},
+			want:    []string{"✨ feat:", "Start the subject with the emoji listed for its type"},
+			notWant: []string{"Do not use emoji anywhere in the output."},
+		},
+		{
+			name: "history",
+			cfg:  Config{Style: "conventional", SubjectMaxLen: 72, History: []string{"fix(api): handle nil body", "docs: update README"}},
+			want: []string{"recent commit subjects", "    fix(api): handle nil body\n", "    docs: update README\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := BuildPrompt(tt.cfg, diff)
+			if !strings.HasSuffix(got, "Staged diff:\n"+strings.TrimSpace(diff)) {
+				t.Errorf("prompt does not end with the diff:\n%s", got)
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(got, w) {
+					t.Errorf("prompt is missing %q:\n%s", w, got)
+				}
+			}
+			for _, w := range tt.notWant {
+				if strings.Contains(got, w) {
+					t.Errorf("prompt contains %q:\n%s", w, got)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildPromptLanguage(t *testing.T) {
+	tests := []struct {
+		language string
+		style    string
+		want     string // "" means no language instruction
+	}{
+		{"", "conventional", ""},
+		{"en", "conventional", ""},
+		{"English", "conventional", ""},
+		{"es", "conventional", "- Write the subject description and body in Spanish, but keep the type prefix (feat, fix, ...) and scope in English.\n"},
+		{"JA", "conventional", "- Write the subject description and body in Japanese, but keep the type prefix (feat, fix, ...) and scope in English.\n"},
+		{"de", "plain", "- Write the subject and body in German.\n"},
+		{"Esperanto", "plain", "- Write the subject and body in Esperanto.\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.language+"/"+tt.style, func(t *testing.T) {
+			got := BuildPrompt(Config{Style: tt.style, SubjectMaxLen: 72, Language: tt.language}, "diff")
+			if tt.want == "" {
+				if strings.Contains(got, "- Write the subject") {
+					t.Errorf("unexpected language instruction:\n%s", got)
+				}
+				return
+			}
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("prompt is missing %q:\n%s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestHistoryCount(t *testing.T) {
+	newTestRepo(t)
+	for _, subject := range []string{"chore: initial import", "fix(api): handle nil body"} {
+		runGit(t, "commit", "-q", "--allow-empty", "-m", subject)
+	}
+	runGit(t, "config", "ai-commit.historyCount", "5")
+
+	cfg, err := ReadConfig(Overrides{Offline: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.HistoryCount != 5 || cfg.History != nil {
+		t.Fatalf("HistoryCount = %d, History = %q; want 5 and no subjects read yet", cfg.HistoryCount, cfg.History)
+	}
+	prompt := BuildPrompt(cfg, "diff")
+	if !strings.Contains(prompt, "    fix(api): handle nil body\n    chore: initial import\n") {
+		t.Errorf("prompt lacks the recent subjects, newest first:\n%s", prompt)
+	}
+}
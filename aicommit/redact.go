@@ -0,0 +1,189 @@
+package aicommit
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Redact returns a form of a secret that is safe to display, e.g.
+// "sk-...abcd": a short prefix and suffix with the middle elided. Short
+// secrets are masked entirely. Anything that prints an API key must use it.
+func Redact(secret string) string {
+	if len(secret) <= 12 {
+		return strings.Repeat("*", len(secret))
+	}
+	return secret[:3] + "..." + secret[len(secret)-4:]
+}
+
+// redactText replaces every occurrence of each secret in text with its
+// redacted form.
+func redactText(text string, secrets ...string) string {
+	for _, secret := range secrets {
+		if len(secret) >= 4 {
+			text = strings.ReplaceAll(text, secret, Redact(secret))
+		}
+	}
+	return text
+}
+
+// sensitiveHeader reports whether an HTTP header name suggests its value is a
+// credential, so it must be redacted in logs.
+func sensitiveHeader(name string) bool {
+	name = strings.ToLower(name)
+	for _, word := range []string{"auth", "token", "key", "secret", "cookie"} {
+		if strings.Contains(name, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactedError wraps an error whose message has had secrets redacted,
+// keeping the original available to errors.Is / errors.As.
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string { return e.msg }
+
+func (e *redactedError) Unwrap() error { return e.err }
+
+// RedactError returns err with any occurrence of the secrets removed from its
+// message. It returns err unchanged if there is nothing to redact.
+func RedactError(err error, secrets ...string) error {
+	if err == nil {
+		return nil
+	}
+	msg := redactText(err.Error(), secrets...)
+	if msg == err.Error() {
+		return err
+	}
+	return &redactedError{msg: msg, err: err}
+}
+
+// secretPatterns match common credential formats inside diff lines. Each
+// match is replaced with redactedSecret.
+var secretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`),             // AWS access key ID
+	regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9._~+/-]{20,}=*`), // Authorization: Bearer ...
+	regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`),          // GitHub token
+	regexp.MustCompile(`\bgithub_pat_[A-Za-z0-9_]{40,}\b`),        // GitHub fine-grained token
+	regexp.MustCompile(`\bsk-[A-Za-z0-9_-]{20,}`),                 // OpenAI / Anthropic style key
+	regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`),          // Slack token
+	regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`),               // Google API key
+}
+
+// secretAssignment matches values assigned to secret-sounding names, such as
+// password = "..." or api_key: ...; the name is kept for context.
+var secretAssignment = regexp.MustCompile(`(?i)((?:password|passwd|secret|token|api[_-]?key)["']?\s*[:=]\s*["']?)[^\s"']{8,}`)
+
+// privateKeyBegin and privateKeyEnd bracket a PEM private key block, whose
+// body lines are redacted entirely.
+var (
+	privateKeyBegin = regexp.MustCompile(`-----BEGIN [A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----`)
+	privateKeyEnd   = regexp.MustCompile(`-----END [A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----`)
+)
+
+// highEntropyToken matches long base64-ish tokens; they are redacted only if
+// their entropy suggests random key material rather than an identifier.
+var highEntropyToken = regexp.MustCompile(`[A-Za-z0-9+/_=-]{32,}`)
+
+const redactedSecret = "[REDACTED]"
+
+// RedactDiff applies scrubDiff when ai-commit.redactSecrets is on and reports
+// the number of redactions on stderr.
+func RedactDiff(cfg Config, diff string) string {
+	if !cfg.RedactSecrets {
+		return diff
+	}
+	scrubbed, n := scrubDiff(diff)
+	if n > 0 {
+		fmt.Fprintf(os.Stderr, "git-ai-commit: redacted %d likely secret(s) from the diff before sending it\n", n)
+	}
+	return scrubbed
+}
+
+// scrubDiff masks likely secrets in the content lines of a diff: known token
+// formats, "password = ..." style assignments, PEM private keys and
+// high-entropy strings. File headers are left alone. It returns the scrubbed
+// diff and the number of redactions.
+func scrubDiff(diff string) (string, int) {
+	count := 0
+	inKey := false
+	lines := strings.Split(diff, "\n")
+	for i, line := range lines {
+		if line == "" || strings.HasPrefix(line, "diff --git ") || strings.HasPrefix(line, "index ") ||
+			strings.HasPrefix(line, "+++ ") || strings.HasPrefix(line, "--- ") || strings.HasPrefix(line, "@@") {
+			continue
+		}
+		prefix, content := line[:1], line[1:]
+		if prefix != "+" && prefix != "-" && prefix != " " {
+			prefix, content = "", line
+		}
+
+		if inKey {
+			if privateKeyEnd.MatchString(content) {
+				inKey = false
+			} else {
+				lines[i] = prefix + redactedSecret
+			}
+			continue
+		}
+		if privateKeyBegin.MatchString(content) {
+			inKey = !privateKeyEnd.MatchString(content)
+			count++
+			continue
+		}
+
+		for _, re := range secretPatterns {
+			content = re.ReplaceAllStringFunc(content, func(string) string {
+				count++
+				return redactedSecret
+			})
+		}
+		if n := len(secretAssignment.FindAllStringIndex(content, -1)); n > 0 {
+			count += n
+			content = secretAssignment.ReplaceAllString(content, "${1}"+redactedSecret)
+		}
+		content = highEntropyToken.ReplaceAllStringFunc(content, func(m string) string {
+			if !looksRandom(m) {
+				return m
+			}
+			count++
+			return redactedSecret
+		})
+		lines[i] = prefix + content
+	}
+	return strings.Join(lines, "\n"), count
+}
+
+// looksRandom reports whether s mixes letters and digits and has a Shannon
+// entropy above what hex hashes (at most 4 bits per character) can reach.
+func looksRandom(s string) bool {
+	var hasDigit, hasLetter bool
+	freq := map[rune]int{}
+	for _, r := range s {
+		freq[r]++
+		switch {
+		case r >= '0' && r <= '9':
+			hasDigit = true
+		case unicode.IsLetter(r):
+			hasLetter = true
+		}
+	}
+	if !hasDigit || !hasLetter {
+		return false
+	}
+	entropy := 0.0
+	n := float64(len(s))
+	for _, c := range freq {
+		p := float64(c) / n
+		entropy -= p * math.Log2(p)
+	}
+	return entropy > 4.5
+}
@@ -0,0 +1,249 @@
+package aicommit
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// RepoConfigFileName is the file at the repository root that a team can
+// commit to share commit conventions without every contributor touching git
+// config.
+const RepoConfigFileName = ".git-ai-commit.toml"
+
+// repoConfigKeys are the settings a repository file may set. Connection
+// settings (endpoint, apiKey, ...) are deliberately excluded: a cloned
+// repository must not be able to redirect diffs or run commands.
+var repoConfigKeys = map[string]bool{
+	"systemPrompt":     true,
+	"style":            true,
+	"scopes":           true,
+	"language":         true,
+	"subjectMaxLength": true,
+	"excludePaths":     true,
+}
+
+// repoConfig holds the values from RepoConfigFileName, keyed by full
+// ai-commit.* name. It is loaded by ReadConfig and consulted by ConfigGet.
+var repoConfig map[string]string
+
+// loadRepoConfig reads RepoConfigFileName from the repository root into
+// repoConfig. A missing file, or running outside a work tree, is not an error.
+func loadRepoConfig() error {
+	repoConfig = nil
+	root, err := getRepoRoot()
+	if err != nil {
+		return nil
+	}
+	file := filepath.Join(root, RepoConfigFileName)
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read %s: %w", RepoConfigFileName, err)
+	}
+	values, err := parseRepoConfig(string(data))
+	if err != nil {
+		return fmt.Errorf("%s:%w", RepoConfigFileName, err)
+	}
+	repoConfig = values
+	Debugf("loaded %d setting(s) from %s", len(values), RepoConfigFileName)
+	return nil
+}
+
+// parseRepoConfig parses the small TOML subset used by RepoConfigFileName:
+// top-level `key = value` pairs where value is a quoted string, a
+// triple-quoted multi-line string, an integer, or a one-line array of
+// strings. Arrays are joined with ", " so they read like comma-separated git
+// config lists. Errors are prefixed with the line number.
+func parseRepoConfig(text string) (map[string]string, error) {
+	values := map[string]string{}
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		n := i + 1
+		line := strings.TrimSpace(lines[i])
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			return nil, fmt.Errorf("%d: tables are not supported; set keys at the top level", n)
+		}
+		key, raw, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		raw = strings.TrimSpace(raw)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("%d: expected key = value", n)
+		}
+		if !repoConfigKeys[key] {
+			return nil, fmt.Errorf("%d: unsupported key %q", n, key)
+		}
+
+		var value string
+		switch {
+		case strings.HasPrefix(raw, `"""`) || strings.HasPrefix(raw, `'''`):
+			delim, rest := raw[:3], raw[3:]
+			// A newline right after the opening delimiter is trimmed, as in TOML.
+			var parts []string
+			if rest != "" {
+				parts = append(parts, rest)
+			}
+			for !strings.Contains(rest, delim) {
+				i++
+				if i == len(lines) {
+					return nil, fmt.Errorf("%d: unterminated multi-line string", n)
+				}
+				rest = lines[i]
+				parts = append(parts, rest)
+			}
+			body := strings.Join(parts, "\n")
+			end := strings.Index(body, delim)
+			if after := strings.TrimSpace(body[end+3:]); after != "" && !strings.HasPrefix(after, "#") {
+				return nil, fmt.Errorf("%d: unexpected text after string", n)
+			}
+			value = body[:end]
+			if delim == `"""` {
+				var err error
+				if value, err = unescapeTOML(value); err != nil {
+					return nil, fmt.Errorf("%d: %w", n, err)
+				}
+			}
+		case strings.HasPrefix(raw, "["):
+			end := strings.LastIndex(raw, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("%d: arrays must be on one line", n)
+			}
+			var items []string
+			for _, item := range strings.Split(raw[1:end], ",") {
+				item = strings.TrimSpace(item)
+				if item == "" {
+					continue
+				}
+				s, err := parseTOMLString(item)
+				if err != nil {
+					return nil, fmt.Errorf("%d: %w", n, err)
+				}
+				items = append(items, s)
+			}
+			value = strings.Join(items, ", ")
+		case strings.HasPrefix(raw, `"`) || strings.HasPrefix(raw, "'"):
+			s, err := parseTOMLString(stripTOMLComment(raw))
+			if err != nil {
+				return nil, fmt.Errorf("%d: %w", n, err)
+			}
+			value = s
+		default:
+			raw = stripTOMLComment(raw)
+			if _, err := strconv.Atoi(raw); err != nil {
+				return nil, fmt.Errorf("%d: value for %s must be a string, integer, or array", n, key)
+			}
+			value = raw
+		}
+		values["ai-commit."+key] = value
+	}
+	return values, nil
+}
+
+// parseTOMLString parses a single-line basic ("...") or literal ('...') string.
+func parseTOMLString(s string) (string, error) {
+	if len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'' {
+		return s[1 : len(s)-1], nil
+	}
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return unescapeTOML(s[1 : len(s)-1])
+	}
+	return "", fmt.Errorf("invalid string %s", s)
+}
+
+// unescapeTOML resolves the escape sequences of a basic string body.
+func unescapeTOML(s string) (string, error) {
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		if i == len(s) {
+			return "", errors.New("string ends with a backslash")
+		}
+		switch c := s[i]; c {
+		case 'b':
+			b.WriteByte('\b')
+		case 't':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'f':
+			b.WriteByte('\f')
+		case 'r':
+			b.WriteByte('\r')
+		case '"', '\\':
+			b.WriteByte(c)
+		case 'u', 'U':
+			size := 4
+			if c == 'U' {
+				size = 8
+			}
+			if i+size >= len(s) {
+				return "", fmt.Errorf("short \\%c escape", c)
+			}
+			r, err := strconv.ParseUint(s[i+1:i+1+size], 16, 32)
+			if err != nil {
+				return "", fmt.Errorf("invalid \\%c escape", c)
+			}
+			b.WriteRune(rune(r))
+			i += size
+		default:
+			return "", fmt.Errorf("invalid escape \\%c", c)
+		}
+	}
+	return b.String(), nil
+}
+
+// stripTOMLComment removes a trailing "# ..." comment from a single-line
+// value, ignoring "#" inside a quoted string.
+func stripTOMLComment(s string) string {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return strings.TrimSpace(s[:i])
+		}
+	}
+	return s
+}
+
+// repoConfigGet returns key from RepoConfigFileName unless the repository's
+// own .git/config sets it, so a contributor can still override the team
+// default locally while the file wins over global and system config.
+func repoConfigGet(key string) (string, bool) {
+	v, ok := repoConfig[key]
+	if !ok {
+		return "", false
+	}
+	cmd := GitCommand("config", "--local", "--get", key)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = io.Discard
+	if cmd.Run() == nil {
+		return strings.TrimRight(out.String(), "\n"), true
+	}
+	return v, true
+}
@@ -0,0 +1,108 @@
+package aicommit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// modelPrice is the list price of a model in USD per 1K tokens.
+type modelPrice struct {
+	Input, Output float64
+}
+
+// modelPrices holds approximate list prices for common models. Keys match
+// a model name exactly or as a prefix (for dated snapshots such as
+// gpt-4o-mini-2024-07-18); the longest matching key wins. Prices change, so
+// ai-commit.priceInputPer1k/priceOutputPer1k take precedence.
+var modelPrices = map[string]modelPrice{
+	"gpt-5":            {0.00125, 0.01},
+	"gpt-5-mini":       {0.00025, 0.002},
+	"gpt-5-nano":       {0.00005, 0.0004},
+	"gpt-4.1":          {0.002, 0.008},
+	"gpt-4.1-mini":     {0.0004, 0.0016},
+	"gpt-4.1-nano":     {0.0001, 0.0004},
+	"gpt-4o":           {0.0025, 0.01},
+	"gpt-4o-mini":      {0.00015, 0.0006},
+	"claude-3-5-haiku": {0.0008, 0.004},
+	"claude-sonnet-4":  {0.003, 0.015},
+	"claude-opus-4":    {0.015, 0.075},
+	"gemini-2.0-flash": {0.0001, 0.0004},
+	"gemini-2.5-flash": {0.0003, 0.0025},
+	"gemini-2.5-pro":   {0.00125, 0.01},
+}
+
+// EstimateCost returns the approximate USD cost of usage for cfg.Model. It
+// reports false when the model has no known price and no override is set.
+func EstimateCost(cfg Config, usage Usage) (float64, bool) {
+	price, known := lookupModelPrice(cfg.Model)
+	if cfg.PriceInputPer1k > 0 {
+		price.Input, known = cfg.PriceInputPer1k, true
+	}
+	if cfg.PriceOutputPer1k > 0 {
+		price.Output, known = cfg.PriceOutputPer1k, true
+	}
+	if !known {
+		return 0, false
+	}
+	return float64(usage.PromptTokens)/1000*price.Input + float64(usage.CompletionTokens)/1000*price.Output, true
+}
+
+// lookupModelPrice finds the modelPrices entry for model, preferring the
+// longest key that model starts with.
+func lookupModelPrice(model string) (modelPrice, bool) {
+	model = strings.ToLower(model)
+	// Strip a provider prefix such as "openai/gpt-4o-mini".
+	if i := strings.LastIndex(model, "/"); i >= 0 {
+		model = model[i+1:]
+	}
+	best := ""
+	for key := range modelPrices {
+		if strings.HasPrefix(model, key) && len(key) > len(best) {
+			best = key
+		}
+	}
+	if best == "" {
+		return modelPrice{}, false
+	}
+	return modelPrices[best], true
+}
+
+// FormatCost renders a USD amount with enough precision for a single
+// request, which often costs a fraction of a cent.
+func FormatCost(usd float64) string {
+	if usd > 0 && usd < 0.0001 {
+		return "<$0.0001"
+	}
+	return fmt.Sprintf("~$%.4f", usd)
+}
+
+// LogUsage appends one JSON line per generated message to ai-commit.usageLog,
+// if set. Failures are only warned about: a missing log must never get in
+// the way of a commit.
+func LogUsage(cfg Config, usage Usage) {
+	if cfg.UsageLog == "" || usage.TotalTokens == 0 {
+		return
+	}
+	entry := struct {
+		Time  string `json:"time"`
+		Model string `json:"model"`
+		Usage
+	}{time.Now().UTC().Format(time.RFC3339), cfg.Model, usage}
+	line, err := json.Marshal(entry)
+	if err == nil {
+		var f *os.File
+		f, err = os.OpenFile(cfg.UsageLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err == nil {
+			_, err = f.Write(append(line, '\n'))
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "git-ai-commit: warning: usage log: %v\n", err)
+	}
+}
@@ -1,27 +1,151 @@
 // git-ai-commit: Prefill Git commit messages using an LLM (OpenAI-compatible API)
 // Usage (hook):
 //
-//	git-ai-commit hook prepare-commit-msg <commit-msg-file> [<source> [<sha>]]
+//	git-ai-commit hook prepare-commit-msg [--profile <name>] [--model <name>] [--verbose] <commit-msg-file> [<source> [<sha>]]
+//	git-ai-commit hook commit-msg [--profile <name>] <commit-msg-file>
 //
 // Usage (show):
 //
-//	git-ai-commit show [--stdin]
+//	git-ai-commit show [--stdin | --diff-file <file> | --hunks <file> | --since <rev> [<rev>]] [--both] [--no-cache] [--subject-only | --full] [--format text|json] [--output <file>] [--profile <name>] [--model <name>] [--endpoint <url>] [--verbose]
+//
+// Usage (commit):
+//
+//	git-ai-commit commit [--edit | --no-edit] [--profile <name>] [--model <name>] [--endpoint <url>] [--verbose]
+//
+// Usage (complete):
+//
+//	git-ai-commit complete [--profile <name>] [--model <name>] [--endpoint <url>] [--verbose]
+//
+// Usage (lint):
+//
+//	git-ai-commit lint [--stdin | <file>] [--profile <name>]
+//
+// Usage (pr):
+//
+//	git-ai-commit pr [--base <branch>] [--profile <name>] [--model <name>] [--endpoint <url>] [--verbose]
+//
+// Usage (notes):
+//
+//	git-ai-commit notes --from <rev> [--to <rev>] [--profile <name>] [--model <name>] [--endpoint <url>] [--verbose]
 //
 // Usage (config):
 //
-//	git-ai-commit config [--global] [--preset openai|anthropic|ollama|lmstudio]
+//	git-ai-commit config [--global] [--preset openai|anthropic|gemini|ollama|lmstudio] [--check]
+//	git-ai-commit config get [--global | --local] <key>
+//	git-ai-commit config set [--global | --local] <key> <value>
+//	git-ai-commit config show [--profile <name>] [--model <name>] [--endpoint <url>]
+//
+// Usage (doctor):
+//
+//	git-ai-commit doctor
+//
+// Usage (cache):
+//
+//	git-ai-commit cache clear
+//
+// Usage (models):
+//
+//	git-ai-commit models [--endpoint <url>] [--verbose]
+//
+// Usage (bench):
+//
+//	git-ai-commit bench --models <name>,<name>,... [--stdin] [--profile <name>] [--endpoint <url>] [--verbose]
 //
 // Usage (install):
 //
-//	git-ai-commit install
+//	git-ai-commit install [--global] [--with-lint]
+//
+// Usage (uninstall):
+//
+//	git-ai-commit uninstall [--force]
 //
 // Git config keys (suggested):
 //
-//	ai-commit.endpoint        (required; base URL up to /v1, e.g. https://api.openai.com/v1)
+//	ai-commit.endpoint        (required; base URL up to /v1, e.g. https://api.openai.com/v1, or unix:///path.sock:/v1)
 //	ai-commit.model           (e.g. gpt-4o-mini)
-//	ai-commit.apiKey          (your API key, or $ENV_VAR, or "git-credentials")
+//	ai-commit.profile         (optional; name of the ai-commit.profiles.<name>.* keys to use)
+//	ai-commit.apiKey          (your API key, or $ENV_VAR, "git-credentials", file:<path>, or exec:<command>)
+//	ai-commit.fallbackEndpoint (optional; endpoint tried when ai-commit.endpoint is unreachable or returns 5xx, e.g. http://localhost:11434/v1)
+//	ai-commit.fallbackModel   (optional; model for fallbackEndpoint; default ai-commit.model)
+//	ai-commit.fallbackApiKey  (optional; API key for fallbackEndpoint, in the same forms as apiKey)
 //	ai-commit.maxDiffBytes    (optional, int; default 200000)
+//	ai-commit.maxTokens       (optional, int; completion token cap, 0 for none — derived from the message shape when unset)
+//	ai-commit.seed            (optional, int; sampling seed for reproducible output, where the provider supports it)
+//	ai-commit.stop            (optional, multi; stop sequence that ends generation, e.g. a code fence)
+//	ai-commit.chunked         (optional, bool; default false — summarize large diffs in parts first)
+//	ai-commit.chunkBytes      (optional, int; default 32000 — largest diff part sent in one request)
 //	ai-commit.timeoutSeconds  (optional, int; default 30)
+//	ai-commit.connectTimeoutSeconds (optional, int; default none — fail fast when the endpoint is unreachable)
+//	ai-commit.credentialTimeoutSeconds (optional, int; default 10 — limit for git credential fill, 0 for none)
+//	ai-commit.envFile         (optional; KEY=VALUE file loaded into the environment, e.g. .env; default none)
+//	ai-commit.sources         (optional; commit sources the hook runs for; default "none,template")
+//	ai-commit.regenerateOnAmend (optional, bool; default false — replace unedited generated messages on --amend)
+//	ai-commit.markerTrailer   (optional, bool; default false — append "X-AI-Commit: <model>" to messages and replace stale marked ones)
+//	ai-commit.stripMarker     (optional, bool; default false — remove X-AI-Commit trailers before writing)
+//	ai-commit.failOpen        (optional, bool; default true — hook errors never block the commit)
+//	ai-commit.usageLog        (optional; file that token usage is appended to as JSON lines)
+//	ai-commit.priceInputPer1k (optional, float; USD per 1K prompt tokens for the cost estimate)
+//	ai-commit.priceOutputPer1k (optional, float; USD per 1K completion tokens for the cost estimate)
+//	ai-commit.organization    (optional; sent as the OpenAI-Organization header)
+//	ai-commit.project         (optional; sent as the OpenAI-Project header)
+//	ai-commit.header.<Name>   (optional, multi; extra HTTP header sent with each request)
+//	ai-commit.apiStyle        (optional; "openai" (default) or "azure")
+//	ai-commit.azureDeployment (required for apiStyle=azure; deployment name)
+//	ai-commit.azureApiVersion (optional for apiStyle=azure; default 2024-10-21)
+//	ai-commit.messagesField   (optional; request field for the messages array; default "messages")
+//	ai-commit.systemRole      (optional; "system" (default) or "developer" — role of the system prompt message)
+//	ai-commit.extraParams     (optional; JSON object merged into every request body, e.g. {"top_p": 0.9})
+//	ai-commit.rawEndpoint     (optional, bool; append only /chat/completions to the endpoint, no /v1)
+//	ai-commit.redactSecrets   (optional, bool; default true — mask likely secrets in the diff)
+//	ai-commit.includeUntracked (optional, bool; default false — also describe untracked files)
+//	ai-commit.includeStat     (optional, bool; default false — start the diff with a --stat summary)
+//	ai-commit.textOnly        (optional, bool; default true — list binary files by name instead of sending their diff)
+//	ai-commit.skipWhitespaceOnly (optional, bool; default false — no LLM call for whitespace-only changes)
+//	ai-commit.cache           (optional, bool; default true — reuse messages for an unchanged diff)
+//	ai-commit.fallback        (optional; "none" (default) or "filelist" — hook message when the LLM fails)
+//	ai-commit.cacheTTLSeconds (optional, int; default 86400)
+//	ai-commit.subjectMaxLength (optional, int; default 72)
+//	ai-commit.style           (optional; "conventional" (default) or "plain")
+//	ai-commit.includeBody     (optional, bool; default true — bullet-point body after the subject)
+//	ai-commit.baseBranch      (optional; default main — branch the pr command compares against)
+//	ai-commit.prIncludeStat   (optional, bool; default false — add a collapsed diff stat to pr output)
+//	ai-commit.wrapBody        (optional, bool; default false — hard-wrap the body at wrapWidth)
+//	ai-commit.wrapWidth       (optional, int; default 72)
+//	ai-commit.structured      (optional, bool; default false — request JSON output via response_format)
+//	ai-commit.retryOnEmpty    (optional, bool; default true — retry once when the model returns an empty message)
+//	ai-commit.subjectOnly     (optional, bool; default false — same as includeBody=false)
+//	ai-commit.bodyThresholdLines (optional, int; default 0 — single-file diffs with fewer changed lines get no body)
+//	ai-commit.gitmoji         (optional, bool; default false — lead subjects with a gitmoji)
+//	ai-commit.extraTypes      (optional; comma-separated Conventional Commits types allowed besides the defaults)
+//	ai-commit.enforceType     (optional, bool; default false — regenerate once on an invalid subject type)
+//	ai-commit.fixImperative   (optional, bool; default false — rewrite "added ..." subjects to "add ...")
+//	ai-commit.scopes          (optional; comma-separated scopes the model must choose from)
+//	ai-commit.historyCount    (optional, int; default 0 — recent commit subjects shown as style examples)
+//	ai-commit.language        (optional; e.g. es, ja, de — default English)
+//	ai-commit.systemPrompt    (optional; replaces the default system message)
+//	ai-commit.coAuthors       (optional; "Name <email>; Name <email>" added as Co-authored-by trailers)
+//	ai-commit.proxy           (optional; proxy URL for LLM requests, or "none" to bypass env proxies)
+//	ai-commit.bannedPhrases   (optional, multi; comma-separated phrases that trigger one regeneration)
+//	ai-commit.stripDisclaimers (optional, bool; default true — drop trailing model disclaimers)
+//	ai-commit.disclaimerPattern (optional, multi; extra regex matching the start of a disclaimer)
+//	ai-commit.caBundle        (optional; path to a PEM file of extra trusted CA certificates)
+//	ai-commit.confirmRemote   (optional, bool; default false — ask before sending a diff to a non-local endpoint)
+//	ai-commit.allowedHosts    (optional; comma-separated hosts the tool may contact, e.g. api.openai.com,*.corp.example)
+//	ai-commit.insecureSkipVerify (optional, bool; default false — disables TLS verification)
+//	ai-commit.excludePaths    (optional; comma-separated .aicommitignore-style patterns kept out of the prompt)
+//	ai-commit.gitBinary       (optional; git executable used for every git command, default git from PATH)
+//
+// A .git-ai-commit.toml file committed at the repository root may set
+// systemPrompt, style, scopes, language, subjectMaxLength and excludePaths
+// for everyone; it overrides global git config but not the repository's own
+// .git/config.
+//
+// Environment variables (override the git config keys above; all but the
+// endpoint, profile and git binary may also be set in ai-commit.envFile):
+//
+//	AI_COMMIT_ENDPOINT, AI_COMMIT_MODEL, AI_COMMIT_API_KEY,
+//	AI_COMMIT_MAX_DIFF_BYTES, AI_COMMIT_TIMEOUT_SECONDS, AI_COMMIT_PROFILE,
+//	AI_COMMIT_GIT, AI_COMMIT_FAIL_OPEN, AI_COMMIT_BANNED_PHRASES
 //
 // Hook example (.git/hooks/prepare-commit-msg):
 //
@@ -30,22 +154,30 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"net/http"
 	"net/url"
 	"os"
 	"os/exec"
-	"path"
+	"os/signal"
 	"path/filepath"
+	"reflect"
+	"regexp"
 	"runtime"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/skkdevcraft/git-ai-commit/aicommit"
 )
 
 // These variables are set at build time via -ldflags.
@@ -56,14 +188,6 @@ var (
 	date    = "unknown"
 )
 
-type config struct {
-	Endpoint       string
-	Model          string
-	APIKey         string
-	MaxDiffBytes   int
-	TimeoutSeconds int
-}
-
 // preset describes a well-known LLM provider configuration.
 type preset struct {
 	Name        string
@@ -71,6 +195,7 @@ type preset struct {
 	Model       string
 	APIKeyHint  string // shown as placeholder if the user hasn't set a key
 	Description string
+	Local       bool // local server that accepts any non-empty key
 }
 
 var presets = []preset{
@@ -88,12 +213,20 @@ var presets = []preset{
 		APIKeyHint:  "sk-ant-...",
 		Description: "Anthropic Claude",
 	},
+	{
+		Name:        "gemini",
+		Endpoint:    "https://generativelanguage.googleapis.com/v1beta/openai",
+		Model:       "gemini-2.0-flash",
+		APIKeyHint:  "AIza...",
+		Description: "Google Gemini (OpenAI-compatible)",
+	},
 	{
 		Name:        "ollama",
 		Endpoint:    "http://localhost:11434/v1",
 		Model:       "llama3",
 		APIKeyHint:  "ollama", // Ollama accepts any non-empty string
 		Description: "Ollama (local)",
+		Local:       true,
 	},
 	{
 		Name:        "lmstudio",
@@ -101,6 +234,7 @@ var presets = []preset{
 		Model:       "local-model",
 		APIKeyHint:  "lm-studio", // LM Studio accepts any non-empty string
 		Description: "LM Studio (local)",
+		Local:       true,
 	},
 	{
 		Name:        "docker",
@@ -108,6 +242,7 @@ var presets = []preset{
 		Model:       "local-model",
 		APIKeyHint:  "lm-studio", // LM Studio accepts any non-empty string
 		Description: "LM Studio (local from container)",
+		Local:       true,
 	},
 }
 
@@ -125,6 +260,21 @@ func main() {
 		printUsageAndExit(2)
 	}
 
+	// Every command except version and help runs git; say so plainly if it
+	// can't be found.
+	switch os.Args[1] {
+	case "version", "--version", "-v", "--help", "-h", "help":
+	default:
+		if err := aicommit.FindGit(); err != nil {
+			fmt.Fprintf(os.Stderr, "git-ai-commit: %v\n", err)
+			if os.Args[1] == "hook" {
+				// Like other hook failures, don't block the commit.
+				os.Exit(0)
+			}
+			os.Exit(1)
+		}
+	}
+
 	switch os.Args[1] {
 	case "version", "--version", "-v":
 		fmt.Printf("git-ai-commit %s\n", version)
@@ -136,20 +286,62 @@ func main() {
 		if len(os.Args) < 3 {
 			printUsageAndExit(2)
 		}
+		if os.Args[2] == "commit-msg" {
+			// Unlike prepare-commit-msg, this hook exists to block commits.
+			if err := runCommitMsg(os.Args[3:]); err != nil {
+				fmt.Fprintf(os.Stderr, "git-ai-commit: %v\n", err)
+				os.Exit(1)
+			}
+			os.Exit(0)
+		}
 		if os.Args[2] != "prepare-commit-msg" {
 			fatalf(2, "unsupported hook: %s", os.Args[2])
 		}
 		if err := runPrepareCommitMsg(os.Args[3:]); err != nil {
 			// In hook mode, default to non-blocking behavior:
 			// do not prevent commits if LLM/network/config fails.
-			// Print to stderr for visibility, then exit 0.
+			// Print to stderr for visibility, then exit 0 — unless the
+			// user opted out with ai-commit.failOpen=false, in which case
+			// the non-zero exit aborts the commit.
 			fmt.Fprintf(os.Stderr, "git-ai-commit: %v\n", err)
+			var closed *failClosedError
+			if errors.As(err, &closed) {
+				fmt.Fprintln(os.Stderr, "git-ai-commit: aborting commit (ai-commit.failOpen is false)")
+				os.Exit(1)
+			}
 			os.Exit(0)
 		}
 		os.Exit(0)
 
 	case "show":
 		if err := runShow(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "git-ai-commit: %v\n", err)
+			if errors.Is(err, errInterrupted) {
+				os.Exit(130)
+			}
+			os.Exit(1)
+		}
+		os.Exit(0)
+
+	case "commit":
+		if err := runCommit(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "git-ai-commit: %v\n", err)
+			if errors.Is(err, errInterrupted) {
+				os.Exit(130)
+			}
+			os.Exit(1)
+		}
+		os.Exit(0)
+
+	case "complete":
+		if err := runComplete(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "git-ai-commit: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+
+	case "lint":
+		if err := runLint(os.Args[2:]); err != nil {
 			fmt.Fprintf(os.Stderr, "git-ai-commit: %v\n", err)
 			os.Exit(1)
 		}
@@ -163,7 +355,59 @@ func main() {
 		os.Exit(0)
 
 	case "install":
-		if err := runInstall(); err != nil {
+		if err := runInstall(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "git-ai-commit: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+
+	case "pr":
+		if err := runPR(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "git-ai-commit: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+
+	case "notes":
+		if err := runNotes(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "git-ai-commit: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+
+	case "models":
+		if err := runModels(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "git-ai-commit: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+
+	case "bench":
+		if err := runBench(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "git-ai-commit: %v\n", err)
+			if errors.Is(err, errInterrupted) {
+				os.Exit(130)
+			}
+			os.Exit(1)
+		}
+		os.Exit(0)
+
+	case "cache":
+		if err := runCache(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "git-ai-commit: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+
+	case "uninstall":
+		if err := runUninstall(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "git-ai-commit: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+
+	case "doctor":
+		if err := runDoctor(); err != nil {
 			fmt.Fprintf(os.Stderr, "git-ai-commit: %v\n", err)
 			os.Exit(1)
 		}
@@ -185,10 +429,23 @@ func printUsageAndExit(code int) {
 	fmt.Fprintln(out, `git-ai-commit
 
 Usage:
-  git-ai-commit hook prepare-commit-msg <commit-msg-file> [<source> [<sha>]]
-  git-ai-commit show
-  git-ai-commit config [--global] [--preset openai|anthropic|ollama|lmstudio]
-  git-ai-commit install
+  git-ai-commit hook prepare-commit-msg [--profile <name>] [--model <name>] [--verbose] <commit-msg-file> [<source> [<sha>]]
+  git-ai-commit hook commit-msg [--profile <name>] <commit-msg-file>
+  git-ai-commit show [--stdin | --diff-file <file> | --hunks <file> | --since <rev> [<rev>]] [--both] [--no-cache] [--subject-only | --full] [--format text|json] [--output <file>] [--profile <name>] [--model <name>] [--endpoint <url>] [--verbose]
+  git-ai-commit commit [--edit | --no-edit] [--profile <name>] [--model <name>] [--endpoint <url>] [--verbose]
+  git-ai-commit complete [--profile <name>] [--model <name>] [--endpoint <url>] [--verbose]
+  git-ai-commit lint [--stdin | <file>] [--profile <name>]
+  git-ai-commit pr [--base <branch>] [--profile <name>] [--model <name>] [--endpoint <url>] [--verbose]
+  git-ai-commit notes --from <rev> [--to <rev>] [--profile <name>] [--model <name>] [--endpoint <url>] [--verbose]
+  git-ai-commit config [--global] [--preset openai|anthropic|gemini|ollama|lmstudio] [--check]
+  git-ai-commit config get|set [--global | --local] <key> [<value>]
+  git-ai-commit config show [--profile <name>] [--model <name>] [--endpoint <url>]
+  git-ai-commit install [--global] [--with-lint]
+  git-ai-commit uninstall [--force]
+  git-ai-commit cache clear
+  git-ai-commit models [--endpoint <url>] [--verbose]
+  git-ai-commit bench --models <name>,<name>,... [--stdin] [--profile <name>] [--endpoint <url>] [--verbose]
+  git-ai-commit doctor
   git-ai-commit version
 
 Commands:
@@ -198,20 +455,101 @@ Commands:
            commit message to stdout, without writing any files.
            Pass --stdin to read the diff from standard input instead, e.g.:
              git diff HEAD~3 | git-ai-commit show --stdin
+           Pass --diff-file <file> to describe a pre-filtered patch, or
+           --hunks <file> to describe only the staged hunks selected by a
+           file of "path[:start-end]" lines; the model is told that it is
+           seeing a partial selection.
+           Pass --since <rev> to describe the committed changes from <rev>
+           to HEAD (or to a second <rev>) instead of the staged diff.
+           Pass --profile <name> to use the ai-commit.profiles.<name>.*
+           settings for one run (also accepted by the hook).
+           Pass --model <name> to override ai-commit.model for one run
+           (also accepted by the hook), and --endpoint <url> to override
+           ai-commit.endpoint.
+           Pass --verbose (or set AI_COMMIT_DEBUG=1) to log the endpoint,
+           model, prompt size, HTTP status and timing to stderr, with the
+           API key redacted. The hook accepts --verbose too.
+           Pass --both to get a short (subject-only) and a long message
+           from a single request, printed under labeled sections.
+           Pass --no-cache to ask the model even when a cached message
+           exists; the new message replaces the cached one.
+           Pass --subject-only (or --no-body) to request just a subject
+           line, or --full to request the bullet body, whatever
+           ai-commit.includeBody and ai-commit.bodyThresholdLines say.
+           Pass --format json to print {"subject", "body", "raw"} instead
+           of plain text (plus "short" with --both).
+           Pass --output <file> (or -o) to write the message to a file,
+           created or overwritten, instead of stdout.
+  commit   Generate a message for the staged diff and run git commit with
+           it. The editor opens on the message first (--edit, the
+           default); pass --no-edit to commit right away. Fails if
+           nothing is staged.
+  complete Read a diff from stdin and print only the generated subject
+           line, for editor integrations, e.g.:
+             git diff --cached | git-ai-commit complete
+  lint     Check an existing commit message, from a file or --stdin,
+           against the same conventions the prompt asks for: subject
+           length, type and scope, imperative mood (best effort), a blank
+           line before the body, banned phrases, emoji and quotes. Prints
+           each problem and exits 1 if there are any. install --with-lint
+           runs it from a commit-msg hook.
+  pr       Write a pull request description (title, summary and testing
+           notes, in Markdown) for the commits on the current branch since
+           it forked from ai-commit.baseBranch (default main), e.g.:
+             git-ai-commit pr | gh pr create --title "..." --body-file -
+           Pass --base <branch> to compare against another branch.
+  notes    Write release notes, grouped into Features, Fixes and Other,
+           from the commit log and diff stat between two revisions, e.g.:
+             git-ai-commit notes --from v1.0.0 --to v1.1.0
+           --to defaults to HEAD.
   config   Print the git config commands needed to configure git-ai-commit.
            Copy and paste the output into your terminal to apply the settings.
+           Pass --check to also probe the preset's endpoint and report
+           whether it is reachable (e.g. whether Ollama is running).
+           "config set <key> <value>" and "config get <key>" run git config
+           for you; the ai-commit. prefix is optional and unknown keys are
+           rejected. set writes to the global config unless --local is given.
+           For multi-valued keys (stop, bannedPhrases, disclaimerPattern,
+           header.<Name>) set adds a value and get prints every value.
+           "config show" prints the effective configuration after all git
+           config layers, profiles, environment variables and flags are
+           applied, including the resolved endpoint URL and where the API
+           key came from. The key itself is masked.
   install  Install the prepare-commit-msg hook into the current repository.
            Will not overwrite an existing hook. Must be run from inside a
-           Git repository.
+           Git repository. Honours core.hooksPath.
+           Pass --global to install it into Git's template directory
+           (init.templateDir, default ~/.git-templates) so that new
+           clones and git init repositories get it.
+           Pass --with-lint to also install a commit-msg hook that runs
+           lint on the final message and aborts commits that break the
+           configured conventions.
+  uninstall
+           Remove the prepare-commit-msg hook, only if it references
+           git-ai-commit. Pass --force to delete any existing hook. A
+           commit-msg lint hook is removed too, if git-ai-commit wrote it.
+  cache    "cache clear" deletes cached messages. Messages are cached per
+           staged diff, endpoint and model under .git/ai-commit-cache, so
+           re-running the hook or show on an unchanged diff skips the LLM
+           call.
+  doctor   Check the setup: resolved config (API key masked), hook wiring,
+           and a tiny live API request. Each check prints PASS or FAIL.
+  models   List the model IDs offered by the configured endpoint (its
+           /models listing), e.g. to find model names on Ollama.
+  bench    Send the staged diff (or --stdin) to each model in --models,
+           one at a time, and print a table of latency, token usage,
+           estimated cost and generated subject, e.g.:
+             git-ai-commit bench --models gpt-4o-mini,gpt-4.1-nano,gpt-5-nano
+           The cache is bypassed; each request gets its own timeout.
   version  Print the version of the tool.
 
 Config flags (for config command):
   --global           Add --global to the generated git config commands
                      (writes to ~/.gitconfig instead of the repo's .git/config).
   --preset <name>    Use a preset endpoint/model for a known provider.
-                     Available presets: openai, anthropic, ollama, lmstudio
+                     Available presets: openai, anthropic, gemini, ollama, lmstudio
 
-API key (ai-commit.apiKey) — three forms accepted:
+API key (ai-commit.apiKey) — five forms accepted:
   sk-...             A literal key value stored in git config.
   $ENV_VAR           Reads the key from the named environment variable at
                      runtime (e.g. $OPENAI_API_KEY). The dollar sign must be
@@ -219,25 +557,64 @@ API key (ai-commit.apiKey) — three forms accepted:
   git-credentials    Delegates to the git credential helper configured for
                      your system. The helper is queried with the protocol and
                      host of ai-commit.endpoint; the password field is used as
-                     the API key.`)
+                     the API key.
+  file:<path>        Reads the key from a file, e.g. a Docker or Kubernetes
+                     secret (file:/run/secrets/openai_key). Trailing newlines
+                     are removed.
+  exec:<command>     Runs the command with sh and uses its trimmed output,
+                     e.g. exec:op read op://vault/openai/key. The command
+                     runs with your privileges; only use config you trust.`)
 	os.Exit(code)
 }
 
 // runInstall installs the prepare-commit-msg hook into the current repo's
-// .git/hooks directory. It will not overwrite an existing hook file.
-func runInstall() error {
+// .git/hooks directory, plus the commit-msg lint hook with --with-lint. It
+// will not overwrite an existing hook file.
+func runInstall(args []string) error {
+	global := false
+	withLint := false
+	for _, a := range args {
+		switch a {
+		case "--global":
+			global = true
+		case "--with-lint":
+			withLint = true
+		default:
+			return fmt.Errorf("unknown flag: %s", a)
+		}
+	}
+	hooks := []string{"prepare-commit-msg"}
+	if withLint {
+		hooks = append(hooks, "commit-msg")
+	}
+	if global {
+		return runInstallGlobal(hooks)
+	}
+
 	// Find the root of the current git repository.
-	gitDir, err := getGitDir()
+	gitDir, err := aicommit.GitDir()
 	if err != nil {
 		return fmt.Errorf("not inside a Git repository (or Git is not installed): %w", err)
 	}
 
-	hooksDir := filepath.Join(gitDir, "hooks")
-	hookFile := filepath.Join(hooksDir, "prepare-commit-msg")
+	hooksDir, err := getHooksDir()
+	if err != nil {
+		return fmt.Errorf("locate hooks directory: %w", err)
+	}
 
 	fmt.Printf("Git directory : %s\n", gitDir)
+	// A linked worktree has its own Git directory, but hooks live in the
+	// common one, so the hook applies to every worktree of the repository.
+	if common, err := aicommit.GitOutput("rev-parse", "--git-common-dir"); err == nil {
+		common, _ = aicommit.AbsGitPath(strings.TrimSpace(common))
+		if common != "" && common != gitDir {
+			fmt.Printf("Common dir     : %s (shared by all worktrees)\n", common)
+		}
+	}
 	fmt.Printf("Hooks directory: %s\n", hooksDir)
-	fmt.Printf("Hook file      : %s\n", hookFile)
+	for _, hook := range hooks {
+		fmt.Printf("Hook file      : %s\n", filepath.Join(hooksDir, hook))
+	}
 	fmt.Println()
 
 	// Create the hooks directory if it somehow doesn't exist yet.
@@ -245,166 +622,923 @@ func runInstall() error {
 		return fmt.Errorf("create hooks directory: %w", err)
 	}
 
-	// Refuse to overwrite an existing hook.
-	if _, err := os.Stat(hookFile); err == nil {
-		// File exists — check whether it already delegates to git-ai-commit.
-		existing, readErr := os.ReadFile(hookFile)
-		if readErr == nil && strings.Contains(string(existing), "git-ai-commit") {
-			fmt.Println("Hook is already installed and references git-ai-commit. Nothing to do.")
-			fmt.Printf("  %s\n", hookFile)
-			return nil
+	// Refuse to overwrite an existing hook. Check them all before writing
+	// any, so a conflict doesn't leave a half-done install.
+	var missing []string
+	for _, hook := range hooks {
+		hookFile := filepath.Join(hooksDir, hook)
+		if _, err := os.Stat(hookFile); err == nil {
+			// File exists — check whether it already delegates to git-ai-commit.
+			existing, readErr := os.ReadFile(hookFile)
+			if readErr == nil && strings.Contains(string(existing), "git-ai-commit") {
+				fmt.Printf("The %s hook is already installed and references git-ai-commit.\n", hook)
+				fmt.Printf("  %s\n", hookFile)
+				continue
+			}
+			return fmt.Errorf(
+				"hook file already exists and was not created by git-ai-commit:\n  %s\n\n"+
+					"To install manually, add the following line to that file:\n  %s",
+				hookFile, hookLine(hook),
+			)
+		} else if !os.IsNotExist(err) {
+			return fmt.Errorf("stat hook file: %w", err)
+		}
+		missing = append(missing, hook)
+	}
+	if len(missing) == 0 {
+		fmt.Println("Nothing to do.")
+		return nil
+	}
+
+	for _, hook := range missing {
+		// Write the hook.
+		hookFile := filepath.Join(hooksDir, hook)
+		content := hookContent(hook)
+		if err := writeNewHook(hookFile, content); err != nil {
+			return fmt.Errorf("write hook file: %w", err)
+		}
+
+		// On Windows the executable bit is meaningless, but we set it anyway for
+		// consistency; Git for Windows reads the shebang line regardless.
+		// On Unix we need the file to be executable — already set via 0o755 above.
+
+		fmt.Printf("Hook installed successfully on %s.\n", osFriendlyName())
+		fmt.Println()
+		fmt.Println("File created:")
+		fmt.Printf("  %s\n", hookFile)
+		fmt.Println()
+		fmt.Println("Contents written:")
+		fmt.Println("  ---")
+		for _, line := range strings.Split(strings.TrimRight(content, "\n"), "\n") {
+			fmt.Printf("  %s\n", line)
+		}
+		fmt.Println("  ---")
+		fmt.Println()
+	}
+	if missing[0] == "prepare-commit-msg" {
+		fmt.Println("Next step: configure your LLM provider by running:")
+		fmt.Println("  git-ai-commit config --preset openai   (or anthropic, gemini, ollama, lmstudio)")
+	}
+	return nil
+}
+
+// runUninstall removes the prepare-commit-msg hook, but only if it references
+// git-ai-commit (the same check install uses to recognise its own hook),
+// unless force is given. A commit-msg lint hook is removed along with it.
+func runUninstall(args []string) error {
+	force := false
+	for _, a := range args {
+		switch a {
+		case "--force":
+			force = true
+		default:
+			return fmt.Errorf("unknown flag: %s", a)
 		}
-		return fmt.Errorf(
-			"hook file already exists and was not created by git-ai-commit:\n  %s\n\n"+
-				"To install manually, add the following line to that file:\n  %s",
-			hookFile, hookLine(),
-		)
-	} else if !os.IsNotExist(err) {
-		return fmt.Errorf("stat hook file: %w", err)
 	}
 
-	// Write the hook.
-	content := hookContent()
-	if err := os.WriteFile(hookFile, []byte(content), 0o755); err != nil {
-		return fmt.Errorf("write hook file: %w", err)
+	hooksDir, err := getHooksDir()
+	if err != nil {
+		return fmt.Errorf("not inside a Git repository (or Git is not installed): %w", err)
+	}
+	hookFile := filepath.Join(hooksDir, "prepare-commit-msg")
+
+	existing, err := os.ReadFile(hookFile)
+	if os.IsNotExist(err) {
+		fmt.Printf("No prepare-commit-msg hook found. Nothing to do.\n  %s\n", hookFile)
+		return removeLintHook(hooksDir)
+	}
+	if err != nil {
+		return fmt.Errorf("read hook file: %w", err)
 	}
 
-	// On Windows the executable bit is meaningless, but we set it anyway for
-	// consistency; Git for Windows reads the shebang line regardless.
-	// On Unix we need the file to be executable — already set via 0o755 above.
+	if !strings.Contains(string(existing), "git-ai-commit") {
+		if !force {
+			return fmt.Errorf(
+				"hook file was not created by git-ai-commit; refusing to remove it:\n  %s\n\n"+
+					"Re-run with --force to delete it anyway.",
+				hookFile,
+			)
+		}
+		fmt.Fprintf(os.Stderr, "git-ai-commit: warning: removing a hook that does not reference git-ai-commit (--force)\n")
+	}
 
-	fmt.Printf("Hook installed successfully on %s.\n", osFriendlyName())
-	fmt.Println()
-	fmt.Println("File created:")
+	if err := os.Remove(hookFile); err != nil {
+		return fmt.Errorf("remove hook file: %w", err)
+	}
+
+	fmt.Println("Hook removed:")
 	fmt.Printf("  %s\n", hookFile)
 	fmt.Println()
-	fmt.Println("Contents written:")
+	fmt.Println("Contents removed:")
 	fmt.Println("  ---")
-	for _, line := range strings.Split(strings.TrimRight(content, "\n"), "\n") {
+	for _, line := range strings.Split(strings.TrimRight(string(existing), "\n"), "\n") {
 		fmt.Printf("  %s\n", line)
 	}
 	fmt.Println("  ---")
-	fmt.Println()
-	fmt.Println("Next step: configure your LLM provider by running:")
-	fmt.Println("  git-ai-commit config --preset openai   (or anthropic, ollama, lmstudio)")
-	return nil
+	return removeLintHook(hooksDir)
 }
 
-// getGitDir returns the absolute path to the .git directory for the current
-// working directory. It uses `git rev-parse --git-dir` so it works in
-// worktrees and repos with non-standard GIT_DIR locations.
-func getGitDir() (string, error) {
-	cmd := exec.Command("git", "rev-parse", "--git-dir")
-	var out bytes.Buffer
-	var errBuf bytes.Buffer
-	cmd.Stdout = &out
-	cmd.Stderr = &errBuf
-	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("%w: %s", err, strings.TrimSpace(errBuf.String()))
+// removeLintHook removes the commit-msg hook written by install --with-lint.
+// A commit-msg hook that does not reference git-ai-commit is left alone,
+// even with --force, since it has nothing to do with this tool.
+func removeLintHook(hooksDir string) error {
+	hookFile := filepath.Join(hooksDir, "commit-msg")
+	existing, err := os.ReadFile(hookFile)
+	if os.IsNotExist(err) || err == nil && !strings.Contains(string(existing), "git-ai-commit") {
+		return nil
 	}
-	raw := strings.TrimSpace(out.String())
-	// The path may be relative (e.g. ".git"); make it absolute.
-	abs, err := filepath.Abs(raw)
 	if err != nil {
-		return "", err
+		return fmt.Errorf("read hook file: %w", err)
 	}
-	return abs, nil
-}
-
-// hookContent returns the full text of the prepare-commit-msg hook script,
-// adapted for the current operating system.
-func hookContent() string {
-	switch runtime.GOOS {
-	case "windows":
-		// Git for Windows ships with a POSIX sh layer, so a sh shebang works.
-		// However some users run Git from plain cmd.exe or PowerShell where
-		// hook scripts must be .bat/.cmd files — but Git itself always invokes
-		// hooks via sh when using Git Bash / MSYS2 / Cygwin, which covers the
-		// vast majority of Windows Git installations. We therefore emit the
-		// same sh script and add a comment explaining this.
-		return "#!/bin/sh\n" +
-			"# git-ai-commit prepare-commit-msg hook (Windows / Git for Windows)\n" +
-			"# Requires git-ai-commit.exe to be on your PATH.\n" +
-			"exec git-ai-commit hook prepare-commit-msg \"$@\"\n"
-	default:
-		// Linux and macOS.
-		return "#!/bin/sh\n" +
-			"# git-ai-commit prepare-commit-msg hook\n" +
-			"exec git-ai-commit hook prepare-commit-msg \"$@\"\n"
+	if err := os.Remove(hookFile); err != nil {
+		return fmt.Errorf("remove hook file: %w", err)
 	}
+	fmt.Println("Lint hook removed:")
+	fmt.Printf("  %s\n", hookFile)
+	return nil
 }
 
-// hookLine returns just the exec line, used in error messages.
-func hookLine() string {
-	return "exec git-ai-commit hook prepare-commit-msg \"$@\""
-}
+// runDoctor checks each part of the setup — Git, configuration, API key, hook
+// wiring and a live API call — and reports each as PASS or FAIL. It returns an
+// error if any check failed.
+func runDoctor() error {
+	failed := 0
+	report := func(ok bool, name, detail string) {
+		status := "PASS"
+		if !ok {
+			status = "FAIL"
+			failed++
+		}
+		fmt.Printf("[%s] %-14s %s\n", status, name, detail)
+	}
 
-// osFriendlyName returns a human-readable OS label for display purposes.
-func osFriendlyName() string {
-	switch runtime.GOOS {
-	case "darwin":
-		return "macOS"
-	case "windows":
-		return "Windows"
-	default:
-		return "Linux"
+	// Git and repository.
+	gitDir, err := aicommit.GitDir()
+	if err != nil {
+		report(false, "repository", fmt.Sprintf("not inside a Git repository: %v", err))
+	} else {
+		report(true, "repository", gitDir)
 	}
-}
 
-// runConfig prints ready-to-paste git config commands for the user.
-func runConfig(args []string) error {
-	global := true   // default to --global
-	presetName := "" // default to openai
+	// Configuration, including API key resolution.
+	cfg, cfgErr := aicommit.ReadConfig(aicommit.Overrides{})
+	if cfgErr != nil {
+		report(false, "config", cfgErr.Error())
+	} else {
+		report(true, "config", fmt.Sprintf("endpoint %s, model %s", cfg.Endpoint, cfg.Model))
+		keyDetail := cfg.APIKeySource
+		if cfg.APIKey != "" {
+			keyDetail += " (" + aicommit.Redact(cfg.APIKey) + ")"
+		}
+		report(true, "api key", keyDetail)
+	}
 
-	// Parse flags manually to keep zero dependencies.
-	for i := 0; i < len(args); i++ {
-		switch args[i] {
-		case "--global":
-			global = true
-		case "--local":
-			global = false
-		case "--preset":
-			i++
-			if i >= len(args) {
-				// use openai as default
+	// Hook wiring.
+	if hooksDir, err := getHooksDir(); err != nil {
+		report(false, "hook", fmt.Sprintf("cannot locate hooks directory: %v", err))
+	} else {
+		hookFile := filepath.Join(hooksDir, "prepare-commit-msg")
+		content, err := os.ReadFile(hookFile)
+		switch {
+		case os.IsNotExist(err):
+			report(false, "hook", "not installed (run git-ai-commit install): "+hookFile)
+		case err != nil:
+			report(false, "hook", err.Error())
+		case !strings.Contains(string(content), "git-ai-commit"):
+			report(false, "hook", "exists but does not call git-ai-commit: "+hookFile)
+		default:
+			report(true, "hook", hookFile)
+		}
+	}
+	if p, err := exec.LookPath("git-ai-commit"); err != nil {
+		report(false, "PATH", "git-ai-commit not found on PATH; the hook will not be able to run it")
+	} else {
+		report(true, "PATH", p)
+	}
+
+	// Live API ping, only if the configuration could be read. The endpoint
+	// and the fallback are checked separately, so one can't hide the other.
+	if cfgErr == nil {
+		ping := func(name string, cfg aicommit.Config) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.TimeoutSeconds)*time.Second)
+			defer cancel()
+			start := time.Now()
+			if _, _, err := aicommit.CallChatCompletions(ctx, cfg, "Reply with the single word OK."); err != nil {
+				report(false, name, err.Error())
 			} else {
-				presetName = args[i]
+				report(true, name, fmt.Sprintf("responded in %s", time.Since(start).Round(time.Millisecond)))
 			}
-		default:
-			return fmt.Errorf("unknown flag: %s", args[i])
+		}
+		fallback, hasFallback := aicommit.FallbackConfig(cfg)
+		cfg.FallbackEndpoint = ""
+		ping("api", cfg)
+		if hasFallback {
+			ping("fallback api", fallback)
 		}
 	}
 
-	// Resolve preset (default: openai).
-	if presetName == "" {
-		presetName = "openai"
+	if failed > 0 {
+		return fmt.Errorf("%d check(s) failed", failed)
 	}
-	p, ok := findPreset(presetName)
-	if !ok {
-		names := make([]string, len(presets))
-		for i, pr := range presets {
-			names[i] = pr.Name
-		}
-		return fmt.Errorf("unknown preset %q — available: %s", presetName, strings.Join(names, ", "))
+	fmt.Println("\nAll checks passed.")
+	return nil
+}
+
+// writeNewHook creates hookFile with content, failing if the file exists by
+// then: two installs at once (say, from two worktrees sharing the hooks
+// directory) must not overwrite each other's hook or one the user just wrote.
+func writeNewHook(hookFile, content string) error {
+	f, err := os.OpenFile(hookFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o755)
+	if errors.Is(err, fs.ErrExist) {
+		return fmt.Errorf("%s was created by someone else while installing; run install again to check it", hookFile)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(content); err != nil {
+		f.Close()
+		return err
 	}
+	return f.Close()
+}
 
-	scopeFlag := ""
-	scopeLabel := "repo-local"
-	if global {
-		scopeFlag = "--global "
-		scopeLabel = "global (~/.gitconfig)"
+// getHooksDir returns the absolute path to the directory Git runs hooks from.
+// It uses `git rev-parse --git-path hooks`, which honours core.hooksPath and,
+// in a linked worktree, resolves to the hooks directory of the common Git
+// directory that all worktrees share.
+func getHooksDir() (string, error) {
+	cmd := aicommit.GitCommand("rev-parse", "--git-path", "hooks")
+	var out bytes.Buffer
+	var errBuf bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &errBuf
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%w: %s", err, strings.TrimSpace(errBuf.String()))
 	}
+	return aicommit.AbsGitPath(strings.TrimSpace(out.String()))
+}
 
-	// Derive a conventional environment-variable name from the preset name,
-	// e.g. "openai" → "OPENAI_API_KEY", "anthropic" → "ANTHROPIC_API_KEY".
-	envVarName := strings.ToUpper(p.Name) + "_API_KEY"
+// defaultTemplateDir is the init.templateDir used by install --global when
+// none is configured yet.
+const defaultTemplateDir = "~/.git-templates"
 
-	// Extract protocol and host from the preset endpoint for the git-credentials example.
-	endpointURL, _ := url.Parse(p.Endpoint)
-	credProtocol := endpointURL.Scheme
-	credHost := endpointURL.Hostname()
+// runInstallGlobal installs the hook into Git's template directory, which
+// git init and git clone copy into every new repository. If init.templateDir
+// is not set it is pointed at ~/.git-templates. Existing repositories are not
+// touched; running git init inside one copies the hook without overwriting
+// anything.
+func runInstallGlobal(hooks []string) error {
+	templateDir, configured := aicommit.GitConfigGet("init.templateDir")
+	templateDir = strings.TrimSpace(templateDir)
+	if templateDir == "" {
+		configured = false
+		templateDir = defaultTemplateDir
+	}
+	dir := aicommit.ExpandHome(templateDir)
 
-	isLocalProvider := p.APIKeyHint != "" && !strings.HasPrefix(p.APIKeyHint, "sk-")
+	fmt.Printf("Template directory: %s\n", dir)
+	for _, hook := range hooks {
+		fmt.Printf("Hook file         : %s\n", filepath.Join(dir, "hooks", hook))
+	}
+	fmt.Println()
+
+	var missing []string
+	for _, hook := range hooks {
+		hookFile := filepath.Join(dir, "hooks", hook)
+		if existing, err := os.ReadFile(hookFile); err == nil {
+			if !strings.Contains(string(existing), "git-ai-commit") {
+				return fmt.Errorf(
+					"template hook already exists and was not created by git-ai-commit:\n  %s\n\n"+
+						"To install manually, add the following line to that file:\n  %s",
+					hookFile, hookLine(hook),
+				)
+			}
+			fmt.Printf("The %s template hook is already installed and references git-ai-commit.\n", hook)
+		} else if !os.IsNotExist(err) {
+			return fmt.Errorf("read template hook: %w", err)
+		} else {
+			missing = append(missing, hookFile)
+		}
+	}
+	for _, hookFile := range missing {
+		if err := os.MkdirAll(filepath.Dir(hookFile), 0o755); err != nil {
+			return fmt.Errorf("create template hooks directory: %w", err)
+		}
+		if err := writeNewHook(hookFile, hookContent(filepath.Base(hookFile))); err != nil {
+			return fmt.Errorf("write template hook: %w", err)
+		}
+	}
+
+	if !configured {
+		cmd := aicommit.GitCommand("config", "--global", "init.templateDir", templateDir)
+		var errBuf bytes.Buffer
+		cmd.Stderr = &errBuf
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("git config --global init.templateDir: %v: %s", err, strings.TrimSpace(errBuf.String()))
+		}
+	}
+
+	fmt.Println("Changes:")
+	for _, hookFile := range missing {
+		fmt.Printf("  created %s\n", hookFile)
+	}
+	if !configured {
+		fmt.Printf("  set git config --global init.templateDir %s\n", templateDir)
+	}
+	if len(missing) == 0 && configured {
+		fmt.Println("  none")
+	}
+	fmt.Println()
+	fmt.Println("New clones and repositories created with git init now get the hook.")
+	fmt.Println("To add it to an existing repository, run `git init` inside it (existing hooks are kept).")
+	fmt.Println()
+	fmt.Println("To undo:")
+	for _, hook := range hooks {
+		fmt.Printf("  rm %s\n", filepath.Join(dir, "hooks", hook))
+	}
+	if !configured {
+		fmt.Println("  git config --global --unset init.templateDir")
+	}
+	fmt.Println("Repositories that already copied the hook keep it; use git-ai-commit uninstall in each.")
+	return nil
+}
+
+// runModels prints the model IDs offered by the configured provider, from the
+// models listing next to the chat completions endpoint.
+func runModels(args []string) (err error) {
+	var ov aicommit.Overrides
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--endpoint":
+			ov.Endpoint, err = flagValue(args, &i)
+		case "--verbose":
+			aicommit.Verbose = true
+		default:
+			return fmt.Errorf("unknown flag: %s", args[i])
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	cfg, err := aicommit.ReadConfig(ov)
+	if err != nil {
+		return err
+	}
+	if cfg.APIStyle == "azure" {
+		return errors.New("listing models is not supported for apiStyle=azure; the model is the deployment named in ai-commit.azureDeployment")
+	}
+	defer func() { err = aicommit.RedactError(err, cfg.APIKey) }()
+
+	u := strings.TrimSuffix(cfg.Endpoint, "/chat/completions") + "/models"
+	if err := aicommit.CheckAllowedHost(cfg.AllowedHosts, u); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.TimeoutSeconds)*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", aicommit.RequestURL(u), nil)
+	if err != nil {
+		return fmt.Errorf("new request: %w", err)
+	}
+	aicommit.SetRequestHeaders(req, cfg)
+	client, err := aicommit.NewHTTPClient(cfg)
+	if err != nil {
+		return err
+	}
+	aicommit.Debugf("GET %s", u)
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("models request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented:
+		return fmt.Errorf("listing models is not supported by this provider (HTTP %d from %s)", resp.StatusCode, u)
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		return fmt.Errorf("models HTTP %d: %s", resp.StatusCode, aicommit.Snippet(body, 200))
+	}
+
+	var parsed struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &parsed); err != nil || parsed.Data == nil {
+		return fmt.Errorf("listing models is not supported by this provider (unexpected response from %s: %s)", u, aicommit.Snippet(body, 200))
+	}
+	ids := make([]string, 0, len(parsed.Data))
+	for _, m := range parsed.Data {
+		ids = append(ids, m.ID)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		fmt.Println(id)
+	}
+	return nil
+}
+
+// benchResult is one row of the bench table.
+type benchResult struct {
+	model   string
+	latency time.Duration
+	usage   aicommit.Usage
+	subject string
+	err     error
+}
+
+// runBench sends the same diff to each model in --models, one after the
+// other with a fresh ai-commit.timeoutSeconds each, and prints a table of
+// latency, token usage, estimated cost and subject line. The cache is
+// bypassed so every model is really asked.
+func runBench(args []string) error {
+	var models []string
+	useStdin := false
+	var ov aicommit.Overrides
+	for i := 0; i < len(args); i++ {
+		var err error
+		switch args[i] {
+		case "--models":
+			var v string
+			v, err = flagValue(args, &i)
+			models = aicommit.SplitList(v)
+		case "--stdin":
+			useStdin = true
+		case "--profile":
+			ov.Profile, err = flagValue(args, &i)
+		case "--endpoint":
+			ov.Endpoint, err = flagValue(args, &i)
+		case "--verbose":
+			aicommit.Verbose = true
+		default:
+			return fmt.Errorf("unknown flag: %s", args[i])
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if len(models) == 0 {
+		return errors.New("bench needs --models <name>,<name>,...")
+	}
+
+	cfg, err := aicommit.ReadConfig(ov)
+	if err != nil {
+		return err
+	}
+	var diff string
+	if useStdin {
+		b, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("read stdin: %w", err)
+		}
+		diff = string(b)
+	} else if diff, err = aicommit.StagedDiff(cfg); err != nil {
+		return err
+	}
+	if strings.TrimSpace(diff) == "" {
+		return errors.New("no diff content — either stage some changes or pipe a diff via --stdin")
+	}
+	warnTruncated(cfg, diff)
+	if err := confirmSend(cfg); err != nil {
+		return err
+	}
+
+	sigCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	var results []benchResult
+	failed := 0
+	for _, model := range models {
+		mcfg := cfg
+		mcfg.Model = model
+		mcfg.FallbackEndpoint = "" // a fallback answer would be credited to model
+		fmt.Fprintf(os.Stderr, "Querying %s (%s)...\n", mcfg.Endpoint, model)
+		ctx, cancel := context.WithTimeout(sigCtx, time.Duration(cfg.TimeoutSeconds)*time.Second)
+		start := time.Now()
+		msg, usage, err := aicommit.GenerateCommitMessage(ctx, mcfg, diff)
+		latency := time.Since(start)
+		cancel()
+		if sigCtx.Err() != nil {
+			return errInterrupted
+		}
+		if err != nil {
+			failed++
+		}
+		subject, _, _ := strings.Cut(strings.TrimSpace(msg), "\n")
+		results = append(results, benchResult{model, latency, usage, subject, err})
+		aicommit.LogUsage(mcfg, usage)
+	}
+
+	width := len("MODEL")
+	for _, r := range results {
+		width = max(width, len(r.model))
+	}
+	fmt.Printf("%-*s  %8s  %13s  %9s  %s\n", width, "MODEL", "LATENCY", "TOKENS IN+OUT", "COST", "SUBJECT")
+	for _, r := range results {
+		tokens, cost := "-", "-"
+		if r.usage.TotalTokens > 0 {
+			tokens = fmt.Sprintf("%d+%d", r.usage.PromptTokens, r.usage.CompletionTokens)
+			mcfg := cfg
+			mcfg.Model = r.model
+			if usd, ok := aicommit.EstimateCost(mcfg, r.usage); ok {
+				cost = aicommit.FormatCost(usd)
+			}
+		}
+		subject := r.subject
+		if r.err != nil {
+			subject = "error: " + r.err.Error()
+		}
+		fmt.Printf("%-*s  %8s  %13s  %9s  %s\n", width, r.model, r.latency.Round(time.Millisecond), tokens, cost, subject)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d models failed", failed, len(models))
+	}
+	return nil
+}
+
+// knownConfigKeys lists every ai-commit.* key git-ai-commit reads, except
+// the ai-commit.header.<Name> family. It is used to catch typos in config set.
+var knownConfigKeys = []string{
+	"ai-commit.allowedHosts", "ai-commit.apiKey", "ai-commit.apiStyle", "ai-commit.azureApiVersion",
+	"ai-commit.azureDeployment", "ai-commit.bannedPhrases", "ai-commit.baseBranch", "ai-commit.bodyThresholdLines",
+	"ai-commit.caBundle", "ai-commit.cache", "ai-commit.cacheTTLSeconds", "ai-commit.chunkBytes",
+	"ai-commit.chunked", "ai-commit.coAuthors", "ai-commit.confirmRemote", "ai-commit.connectTimeoutSeconds",
+	"ai-commit.credentialTimeoutSeconds", "ai-commit.disclaimerPattern", "ai-commit.endpoint",
+	"ai-commit.enforceType", "ai-commit.envFile", "ai-commit.excludePaths", "ai-commit.extraParams",
+	"ai-commit.extraTypes", "ai-commit.failOpen", "ai-commit.fallback", "ai-commit.fallbackApiKey",
+	"ai-commit.fallbackEndpoint", "ai-commit.fallbackModel", "ai-commit.fixImperative", "ai-commit.gitBinary",
+	"ai-commit.gitmoji", "ai-commit.historyCount", "ai-commit.includeBody", "ai-commit.includeStat",
+	"ai-commit.includeUntracked", "ai-commit.insecureSkipVerify", "ai-commit.language", "ai-commit.markerTrailer",
+	"ai-commit.maxDiffBytes", "ai-commit.maxTokens", "ai-commit.messagesField", "ai-commit.model",
+	"ai-commit.organization", "ai-commit.prIncludeStat", "ai-commit.priceInputPer1k", "ai-commit.priceOutputPer1k",
+	"ai-commit.profile", "ai-commit.project", "ai-commit.proxy", "ai-commit.rawEndpoint",
+	"ai-commit.redactSecrets", "ai-commit.regenerateOnAmend", "ai-commit.retryOnEmpty", "ai-commit.scopes",
+	"ai-commit.seed", "ai-commit.skipWhitespaceOnly", "ai-commit.sources", "ai-commit.stop",
+	"ai-commit.stripDisclaimers", "ai-commit.stripMarker", "ai-commit.structured", "ai-commit.style",
+	"ai-commit.subjectMaxLength", "ai-commit.subjectOnly", "ai-commit.systemPrompt", "ai-commit.systemRole",
+	"ai-commit.textOnly", "ai-commit.timeoutSeconds", "ai-commit.usageLog", "ai-commit.wrapBody",
+	"ai-commit.wrapWidth",
+}
+
+// multiValuedConfigKeys are the keys that may be set several times; config
+// set adds a value to them and config get prints every value.
+var multiValuedConfigKeys = []string{
+	"ai-commit.bannedPhrases", "ai-commit.disclaimerPattern", "ai-commit.stop",
+}
+
+// multiValuedConfigKey reports whether the canonical key, or the key a
+// profile key overrides, is one of multiValuedConfigKeys or a custom header.
+func multiValuedConfigKey(key string) bool {
+	if rest, ok := strings.CutPrefix(key, "ai-commit.profiles."); ok {
+		_, sub, _ := strings.Cut(rest, ".")
+		key = "ai-commit." + sub
+	}
+	return strings.HasPrefix(key, "ai-commit.header.") || slices.Contains(multiValuedConfigKeys, key)
+}
+
+// runConfigGetSet implements `config get <key>` and `config set <key> <value>`
+// on top of git config. The "ai-commit." prefix may be omitted. Like the
+// preset printer, set writes to the global config unless --local is given;
+// get reads the effective value unless --global or --local is given. For
+// multi-valued keys, set adds a value and get prints all of them, one per
+// line.
+func runConfigGetSet(action string, args []string) error {
+	scope := ""
+	var positional []string
+	for _, a := range args {
+		switch a {
+		case "--global", "--local":
+			scope = a
+		default:
+			if strings.HasPrefix(a, "--") {
+				return fmt.Errorf("unknown flag: %s", a)
+			}
+			positional = append(positional, a)
+		}
+	}
+	want := 1
+	if action == "set" {
+		want = 2
+		if scope == "" {
+			scope = "--global"
+		}
+	}
+	if len(positional) != want {
+		if action == "set" {
+			return errors.New("usage: git-ai-commit config set [--global | --local] <key> <value>")
+		}
+		return errors.New("usage: git-ai-commit config get [--global | --local] <key>")
+	}
+
+	key, err := canonicalConfigKey(positional[0])
+	if err != nil {
+		return err
+	}
+
+	multi := multiValuedConfigKey(key)
+	gitArgs := []string{"config"}
+	if scope != "" {
+		gitArgs = append(gitArgs, scope)
+	}
+	switch {
+	case action == "get" && multi:
+		gitArgs = append(gitArgs, "--get-all", key)
+	case action == "get":
+		gitArgs = append(gitArgs, "--get", key)
+	case multi:
+		gitArgs = append(gitArgs, "--add", key, positional[1])
+	default:
+		gitArgs = append(gitArgs, key, positional[1])
+	}
+	cmd := aicommit.GitCommand(gitArgs...)
+	var out bytes.Buffer
+	var errBuf bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &errBuf
+	if err := cmd.Run(); err != nil {
+		if action == "get" && errBuf.Len() == 0 {
+			return fmt.Errorf("%s is not set", key)
+		}
+		return fmt.Errorf("git config failed: %v: %s", err, strings.TrimSpace(errBuf.String()))
+	}
+
+	if action == "get" {
+		fmt.Println(printableConfigValue(key, strings.TrimRight(out.String(), "\n")))
+		return nil
+	}
+	if multi {
+		fmt.Printf("git config %s --add %s %s\n", scope, key, printableConfigValue(key, positional[1]))
+		return nil
+	}
+	fmt.Printf("git config %s %s %s\n", scope, key, printableConfigValue(key, positional[1]))
+	return nil
+}
+
+// printableConfigValue masks value for printing if key holds an API key and
+// value is the literal key; references ($VAR, git-credentials, file:,
+// exec:) are shown as they are.
+func printableConfigValue(key, value string) string {
+	if key != "ai-commit.apiKey" && key != "ai-commit.fallbackApiKey" {
+		return value
+	}
+	if strings.HasPrefix(value, "$") || strings.EqualFold(value, "git-credentials") || strings.HasPrefix(value, "file:") || strings.HasPrefix(value, "exec:") {
+		return value
+	}
+	return aicommit.Redact(value)
+}
+
+// runConfigShow implements `config show`: it prints every field of the
+// configuration ReadConfig resolves from all git config layers, the
+// environment and the given flags, with the API key and header values
+// masked.
+func runConfigShow(args []string) error {
+	var ov aicommit.Overrides
+	for i := 0; i < len(args); i++ {
+		var err error
+		switch args[i] {
+		case "--profile":
+			ov.Profile, err = flagValue(args, &i)
+		case "--model":
+			ov.Model, err = flagValue(args, &i)
+		case "--endpoint":
+			ov.Endpoint, err = flagValue(args, &i)
+		default:
+			return fmt.Errorf("unknown flag: %s", args[i])
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	cfg, err := aicommit.ReadConfig(ov)
+	if err != nil {
+		return err
+	}
+
+	v := reflect.ValueOf(cfg)
+	for i := 0; i < v.NumField(); i++ {
+		name := v.Type().Field(i).Name
+		var value string
+		switch f := v.Field(i).Interface().(type) {
+		case *http.Client:
+			continue
+		case *int:
+			if f != nil {
+				value = strconv.Itoa(*f)
+			}
+		case json.RawMessage:
+			value = string(f)
+		case http.Header:
+			names := make([]string, 0, len(f))
+			for h := range f {
+				names = append(names, h)
+			}
+			sort.Strings(names)
+			var parts []string
+			for _, h := range names {
+				for _, hv := range f[h] {
+					parts = append(parts, h+": "+aicommit.Redact(hv))
+				}
+			}
+			value = strings.Join(parts, ", ")
+		case []*regexp.Regexp:
+			var parts []string
+			for _, re := range f {
+				parts = append(parts, re.String())
+			}
+			value = strings.Join(parts, ", ")
+		case []string:
+			value = strings.Join(f, ", ")
+		case string:
+			value = f
+			switch name {
+			case "APIKey", "FallbackAPIKey":
+				value = aicommit.Redact(f)
+			case "SystemPrompt":
+				// Show where a long or multi-line prompt starts, not all of it.
+				if first, _, _ := strings.Cut(f, "\n"); len(first) > 60 || first != f {
+					value = fmt.Sprintf("%.60s... (%d chars)", first, len(f))
+				}
+			}
+		default:
+			value = fmt.Sprint(f)
+			if name == "MaxTokens" && value == "-1" {
+				value = "(derived per message)"
+			}
+		}
+		if value == "" {
+			value = "(none)"
+		}
+		fmt.Printf("%-22s %s\n", name, value)
+	}
+	return nil
+}
+
+// canonicalConfigKey validates a key given to config get/set and returns it
+// with the ai-commit. prefix and canonical casing. Unknown keys are rejected
+// with a suggestion when they look like a typo of a known one.
+func canonicalConfigKey(key string) (string, error) {
+	if !strings.HasPrefix(strings.ToLower(key), "ai-commit.") {
+		key = "ai-commit." + key
+	}
+	if strings.HasPrefix(strings.ToLower(key), "ai-commit.header.") && len(key) > len("ai-commit.header.") {
+		return "ai-commit.header." + key[len("ai-commit.header."):], nil
+	}
+	// ai-commit.profiles.<name>.<key> takes any key a profile can override.
+	if rest, ok := strings.CutPrefix(key, "ai-commit.profiles."); ok {
+		name, sub, found := strings.Cut(rest, ".")
+		if !found || name == "" || strings.Contains(sub, ".") {
+			return "", fmt.Errorf("invalid profile key %s (expected ai-commit.profiles.<name>.<key>)", key)
+		}
+		inner, err := canonicalConfigKey(sub)
+		if err != nil {
+			return "", err
+		}
+		if inner == "ai-commit.profile" {
+			return "", fmt.Errorf("%s cannot be set per profile", inner)
+		}
+		return "ai-commit.profiles." + name + "." + strings.TrimPrefix(inner, "ai-commit."), nil
+	}
+	best, bestDist := "", 4
+	for _, k := range knownConfigKeys {
+		if strings.EqualFold(k, key) {
+			return k, nil
+		}
+		if d := editDistance(strings.ToLower(k), strings.ToLower(key)); d < bestDist {
+			best, bestDist = k, d
+		}
+	}
+	if best != "" {
+		return "", fmt.Errorf("unknown config key %s (did you mean %s?)", key, best)
+	}
+	return "", fmt.Errorf("unknown config key %s — see the configuration reference in the README", key)
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// hookContent returns the full text of the script for hook (prepare-commit-msg
+// or commit-msg), adapted for the current operating system.
+func hookContent(hook string) string {
+	switch runtime.GOOS {
+	case "windows":
+		// Git for Windows ships with a POSIX sh layer, so a sh shebang works.
+		// However some users run Git from plain cmd.exe or PowerShell where
+		// hook scripts must be .bat/.cmd files — but Git itself always invokes
+		// hooks via sh when using Git Bash / MSYS2 / Cygwin, which covers the
+		// vast majority of Windows Git installations. We therefore emit the
+		// same sh script and add a comment explaining this.
+		return "#!/bin/sh\n" +
+			"# git-ai-commit " + hook + " hook (Windows / Git for Windows)\n" +
+			"# Requires git-ai-commit.exe to be on your PATH.\n" +
+			hookLine(hook) + "\n"
+	default:
+		// Linux and macOS.
+		return "#!/bin/sh\n" +
+			"# git-ai-commit " + hook + " hook\n" +
+			hookLine(hook) + "\n"
+	}
+}
+
+// hookLine returns just the exec line for hook, used in error messages.
+func hookLine(hook string) string {
+	return "exec git-ai-commit hook " + hook + " \"$@\""
+}
+
+// osFriendlyName returns a human-readable OS label for display purposes.
+func osFriendlyName() string {
+	switch runtime.GOOS {
+	case "darwin":
+		return "macOS"
+	case "windows":
+		return "Windows"
+	default:
+		return "Linux"
+	}
+}
+
+// runConfig prints ready-to-paste git config commands for the user.
+func runConfig(args []string) error {
+	if len(args) > 0 && (args[0] == "get" || args[0] == "set") {
+		return runConfigGetSet(args[0], args[1:])
+	}
+	if len(args) > 0 && args[0] == "show" {
+		return runConfigShow(args[1:])
+	}
+
+	global := true   // default to --global
+	presetName := "" // default to openai
+	check := false
+
+	// Parse flags manually to keep zero dependencies.
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--global":
+			global = true
+		case "--local":
+			global = false
+		case "--check":
+			check = true
+		case "--preset":
+			i++
+			if i >= len(args) {
+				// use openai as default
+			} else {
+				presetName = args[i]
+			}
+		default:
+			return fmt.Errorf("unknown flag: %s", args[i])
+		}
+	}
+
+	// Resolve preset (default: openai).
+	if presetName == "" {
+		presetName = "openai"
+	}
+	p, ok := findPreset(presetName)
+	if !ok {
+		names := make([]string, len(presets))
+		for i, pr := range presets {
+			names[i] = pr.Name
+		}
+		return fmt.Errorf("unknown preset %q — available: %s", presetName, strings.Join(names, ", "))
+	}
+
+	scopeFlag := ""
+	scopeLabel := "repo-local"
+	if global {
+		scopeFlag = "--global "
+		scopeLabel = "global (~/.gitconfig)"
+	}
+
+	// Derive a conventional environment-variable name from the preset name,
+	// e.g. "openai" → "OPENAI_API_KEY", "anthropic" → "ANTHROPIC_API_KEY".
+	envVarName := strings.ToUpper(p.Name) + "_API_KEY"
+
+	// Extract protocol and host from the preset endpoint for the git-credentials example.
+	endpointURL, _ := url.Parse(p.Endpoint)
+	credProtocol := endpointURL.Scheme
+	credHost := endpointURL.Hostname()
+
+	isLocalProvider := p.Local
 
 	fmt.Printf("# git-ai-commit configuration — %s (%s)\n", p.Description, scopeLabel)
 	fmt.Println("# Copy and paste the commands below into your terminal.")
@@ -459,507 +1593,1080 @@ func runConfig(args []string) error {
 		if pr.Name == p.Name {
 			marker = "* "
 		}
-		fmt.Printf("#   %s%-10s  %s  (%s)\n", marker, pr.Name, pr.Endpoint, pr.Model)
+		fmt.Printf("#   %s%-10s  %s  (%s)\n", marker, pr.Name, pr.Endpoint, pr.Model)
+	}
+
+	if check {
+		fmt.Println()
+		probeURL, err := modelsURL(p.Endpoint)
+		if err != nil {
+			return err
+		}
+		allowed, _ := aicommit.ConfigGet("ai-commit.allowedHosts")
+		if err := aicommit.CheckAllowedHost(aicommit.SplitList(allowed), probeURL); err != nil {
+			fmt.Printf("# Endpoint check: skipped — %v\n", err)
+		} else if status, err := probeEndpoint(probeURL); err != nil {
+			fmt.Printf("# Endpoint check: NOT reachable — %v\n", err)
+			if isLocalProvider {
+				fmt.Println("#   Is the local server running? Start it and re-run with --check.")
+			}
+		} else {
+			fmt.Printf("# Endpoint check: reachable (HTTP %d from %s)\n", status, probeURL)
+		}
+	}
+
+	return nil
+}
+
+// modelsURL derives the models listing URL from an endpoint base URL, using
+// the same normalisation as the chat completions URL.
+func modelsURL(base string) (string, error) {
+	u, err := aicommit.ResolveChatCompletionsEndpoint(base)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(u, "/chat/completions") + "/models", nil
+}
+
+// probeEndpoint sends an unauthenticated GET to u and returns the HTTP status.
+// Any response, even 401, shows that the server is up; only a connection
+// failure or timeout is an error.
+func probeEndpoint(u string) (int, error) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(u)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// runCache implements the cache subcommand.
+func runCache(args []string) error {
+	if len(args) != 1 || args[0] != "clear" {
+		return errors.New("usage: git-ai-commit cache clear")
+	}
+	gitDir, err := aicommit.GitDir()
+	if err != nil {
+		return fmt.Errorf("not inside a Git repository (or Git is not installed): %w", err)
+	}
+	dir := filepath.Join(gitDir, aicommit.CacheDirName)
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("clear cache: %w", err)
+	}
+	fmt.Printf("Cleared %s\n", dir)
+	return nil
+}
+
+// runShow generates a commit message from the staged diff and prints it to
+// stdout, or writes it to the --output file. Unlike the hook path, errors are
+// fatal — the user is explicitly asking for output.
+func runShow(args []string) (err error) {
+	useStdin := false
+	both := false
+	noCache := false
+	diffFile := ""
+	hunksFile := ""
+	sinceRev, untilRev := "", ""
+	format := "text"
+	outputFile := ""
+	var ov aicommit.Overrides
+	for i := 0; i < len(args); i++ {
+		var err error
+		switch args[i] {
+		case "--format":
+			format, err = flagValue(args, &i)
+		case "--output", "-o":
+			outputFile, err = flagValue(args, &i)
+		case "--subject-only", "--no-body":
+			ov.Body = "subject"
+		case "--full":
+			ov.Body = "full"
+		case "--stdin":
+			useStdin = true
+		case "--both":
+			both = true
+		case "--no-cache":
+			noCache = true
+		case "--diff-file":
+			diffFile, err = flagValue(args, &i)
+		case "--hunks":
+			hunksFile, err = flagValue(args, &i)
+		case "--since":
+			sinceRev, err = flagValue(args, &i)
+			// An optional second revision ends the range instead of HEAD.
+			if err == nil && i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+				i++
+				untilRev = args[i]
+			}
+		case "--profile":
+			ov.Profile, err = flagValue(args, &i)
+		case "--model":
+			ov.Model, err = flagValue(args, &i)
+		case "--endpoint":
+			ov.Endpoint, err = flagValue(args, &i)
+		case "--verbose":
+			aicommit.Verbose = true
+		default:
+			return fmt.Errorf("unknown flag: %s", args[i])
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if useStdin && diffFile != "" {
+		return errors.New("--stdin and --diff-file cannot be used together")
+	}
+	if sinceRev != "" && (useStdin || diffFile != "" || hunksFile != "") {
+		return errors.New("--since cannot be combined with --stdin, --diff-file or --hunks")
+	}
+	if format != "text" && format != "json" {
+		return fmt.Errorf("unknown --format %q (expected text or json)", format)
+	}
+
+	var out io.Writer = os.Stdout
+	if outputFile != "" {
+		// Collect the output and only replace the file once a message was
+		// produced, so a failed run leaves an existing file alone.
+		var buf bytes.Buffer
+		out = &buf
+		defer func() {
+			if err == nil {
+				if werr := os.WriteFile(outputFile, buf.Bytes(), 0o644); werr != nil {
+					err = fmt.Errorf("write --output file: %w", werr)
+				}
+			}
+		}()
+	}
+
+	cfg, err := aicommit.ReadConfig(ov)
+	if err != nil {
+		return err
+	}
+
+	var diff string
+	switch {
+	case useStdin:
+		b, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("read stdin: %w", err)
+		}
+		diff = string(b)
+	case diffFile != "":
+		// A pre-filtered patch: describe exactly this selection.
+		b, err := os.ReadFile(diffFile)
+		if err != nil {
+			return fmt.Errorf("read diff file: %w", err)
+		}
+		diff = aicommit.MarkPartialDiff(string(b))
+	case sinceRev != "":
+		if untilRev == "" {
+			untilRev = "HEAD"
+		}
+		diff, err = aicommit.RangeDiff(cfg, sinceRev, untilRev)
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(diff) == "" {
+			return fmt.Errorf("no changes between %s and %s", sinceRev, untilRev)
+		}
+	default:
+		// Select hunks before truncating, so the limit applies to the selection.
+		unlimited := cfg
+		unlimited.MaxDiffBytes = 0
+		// A stat of the whole index would contradict a hunk selection.
+		unlimited.IncludeStat = cfg.IncludeStat && hunksFile == ""
+		diff, err = aicommit.StagedDiff(unlimited)
+		if err != nil {
+			return err
+		}
+		if hunksFile != "" {
+			specs, err := aicommit.ReadHunkSpecs(hunksFile)
+			if err != nil {
+				return err
+			}
+			diff = aicommit.FilterDiffHunks(diff, specs)
+			if strings.TrimSpace(diff) == "" {
+				return fmt.Errorf("no staged hunks match the selection in %s", hunksFile)
+			}
+			diff = aicommit.MarkPartialDiff(diff)
+		}
+		diff = aicommit.TruncateDiff(diff, cfg.DiffLimit())
+	}
+
+	if strings.TrimSpace(diff) == "" {
+		return errors.New("no diff content — either stage some changes or pipe a diff via --stdin")
+	}
+	warnTruncated(cfg, diff)
+
+	if !both && !useStdin && diffFile == "" && sinceRev == "" && hunksFile == "" && whitespaceOnly(cfg, "") {
+		fmt.Fprintln(os.Stderr, "Only whitespace changed; using a fixed message (ai-commit.skipWhitespaceOnly).")
+		return printShowMessage(out, cfg, aicommit.WhitespaceOnlyMessage(cfg), "", nil, format)
+	}
+	if !both && !noCache {
+		if msg, ok := aicommit.CachedMessage(cfg, diff); ok {
+			fmt.Fprintln(os.Stderr, "Using cached message (run git-ai-commit cache clear to discard).")
+			return printShowMessage(out, cfg, msg, "", nil, format)
+		}
+	}
+
+	if err := confirmSend(cfg); err != nil {
+		return err
+	}
+
+	// Ctrl-C cancels the request instead of leaving it to run out the
+	// timeout.
+	sigCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctx, cancel := context.WithTimeout(sigCtx, time.Duration(cfg.TimeoutSeconds)*time.Second)
+	defer cancel()
+
+	fmt.Fprintf(os.Stderr, "Querying %s (%s)...\n", cfg.Endpoint, cfg.Model)
+	stopProgress := startProgress(time.Duration(cfg.TimeoutSeconds) * time.Second)
+
+	if both {
+		short, long, usage, err := aicommit.GenerateShortAndLong(ctx, cfg, diff)
+		stopProgress()
+		if sigCtx.Err() != nil {
+			return errInterrupted
+		}
+		if err != nil {
+			return err
+		}
+		reportUsage(cfg, usage)
+		if format == "json" {
+			return printShowMessage(out, cfg, long, short, &usage, format)
+		}
+		fmt.Fprintf(out, "== Short ==\n%s\n\n== Long ==\n%s", short, aicommit.AddCoAuthors(cfg, long, ""))
+		return nil
+	}
+
+	msg, usage, err := aicommit.GenerateCommitMessage(ctx, cfg, diff)
+	stopProgress()
+	if sigCtx.Err() != nil {
+		return errInterrupted
+	}
+	if err != nil {
+		return err
+	}
+	aicommit.StoreMessage(cfg, diff, msg)
+	reportUsage(cfg, usage)
+
+	return printShowMessage(out, cfg, msg, "", &usage, format)
+}
+
+// whitespaceOnly reports whether ai-commit.skipWhitespaceOnly is on and the
+// staged changes against base only touch whitespace, so the model need not
+// be asked. A failed check is treated as "no".
+func whitespaceOnly(cfg aicommit.Config, base string) bool {
+	if !cfg.SkipWhitespaceOnly {
+		return false
+	}
+	ws, err := aicommit.StagedWhitespaceOnly(base)
+	if err != nil {
+		aicommit.Debugf("whitespace-only check failed: %v", err)
+	}
+	return ws
+}
+
+// runCommit generates a message for the staged diff and runs git commit with
+// it, opening the editor on it first unless --no-edit is given.
+func runCommit(args []string) error {
+	edit := true
+	var ov aicommit.Overrides
+	for i := 0; i < len(args); i++ {
+		var err error
+		switch args[i] {
+		case "--edit", "-e":
+			edit = true
+		case "--no-edit":
+			edit = false
+		case "--profile":
+			ov.Profile, err = flagValue(args, &i)
+		case "--model":
+			ov.Model, err = flagValue(args, &i)
+		case "--endpoint":
+			ov.Endpoint, err = flagValue(args, &i)
+		case "--verbose":
+			aicommit.Verbose = true
+		default:
+			return fmt.Errorf("unknown flag: %s", args[i])
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	cfg, err := aicommit.ReadConfig(ov)
+	if err != nil {
+		return err
+	}
+	diff, err := aicommit.StagedDiff(cfg)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(diff) == "" {
+		return errors.New("nothing staged to commit (use git add first)")
+	}
+	warnTruncated(cfg, diff)
+
+	msg, ok := aicommit.CachedMessage(cfg, diff)
+	switch {
+	case whitespaceOnly(cfg, ""):
+		fmt.Fprintln(os.Stderr, "Only whitespace changed; using a fixed message (ai-commit.skipWhitespaceOnly).")
+		msg = aicommit.WhitespaceOnlyMessage(cfg)
+	case ok:
+		fmt.Fprintln(os.Stderr, "Using cached message (run git-ai-commit cache clear to discard).")
+	default:
+		if err := confirmSend(cfg); err != nil {
+			return err
+		}
+		sigCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		ctx, cancel := context.WithTimeout(sigCtx, time.Duration(cfg.TimeoutSeconds)*time.Second)
+		defer cancel()
+
+		fmt.Fprintf(os.Stderr, "Querying %s (%s)...\n", cfg.Endpoint, cfg.Model)
+		stopProgress := startProgress(time.Duration(cfg.TimeoutSeconds) * time.Second)
+		var usage aicommit.Usage
+		msg, usage, err = aicommit.GenerateCommitMessage(ctx, cfg, diff)
+		stopProgress()
+		if sigCtx.Err() != nil {
+			return errInterrupted
+		}
+		if err != nil {
+			return err
+		}
+		aicommit.StoreMessage(cfg, diff, msg)
+		reportUsage(cfg, usage)
+	}
+
+	msg = aicommit.AddCoAuthors(cfg, msg, "")
+	if cfg.MarkerTrailer {
+		msg = aicommit.AddMarker(cfg, msg)
+	}
+	if cfg.StripMarker {
+		msg = aicommit.StripMarker(msg)
+	}
+	if edit {
+		// Git strips comment lines from an edited message.
+		msg = aicommit.EscapeCommentLines(msg, aicommit.GitCommentChar())
+	}
+
+	// Pass the message in a file: stdin stays with the editor.
+	f, err := os.CreateTemp("", "git-ai-commit-*.txt")
+	if err != nil {
+		return fmt.Errorf("create message file: %w", err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(msg); err != nil {
+		f.Close()
+		return fmt.Errorf("write message file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("write message file: %w", err)
+	}
+
+	gitArgs := []string{"commit", "-F", f.Name()}
+	if edit {
+		gitArgs = append(gitArgs, "--edit")
+	}
+	cmd := aicommit.GitCommand(gitArgs...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("git commit failed: %w", err)
+	}
+	return nil
+}
+
+// runComplete reads a diff from stdin and prints only the generated subject
+// line, for editor plugins that want a minimal contract: one line on stdout,
+// errors on stderr, nothing else.
+func runComplete(args []string) error {
+	ov := aicommit.Overrides{Body: "subject"}
+	for i := 0; i < len(args); i++ {
+		var err error
+		switch args[i] {
+		case "--profile":
+			ov.Profile, err = flagValue(args, &i)
+		case "--model":
+			ov.Model, err = flagValue(args, &i)
+		case "--endpoint":
+			ov.Endpoint, err = flagValue(args, &i)
+		case "--verbose":
+			aicommit.Verbose = true
+		default:
+			return fmt.Errorf("unknown flag: %s", args[i])
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	cfg, err := aicommit.ReadConfig(ov)
+	if err != nil {
+		return err
+	}
+	b, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return fmt.Errorf("read stdin: %w", err)
+	}
+	diff := string(b)
+	if strings.TrimSpace(diff) == "" {
+		return errors.New("no diff on stdin")
+	}
+
+	msg, ok := aicommit.CachedMessage(cfg, diff)
+	if !ok {
+		if err := confirmSend(cfg); err != nil {
+			return err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.TimeoutSeconds)*time.Second)
+		defer cancel()
+		var usage aicommit.Usage
+		msg, usage, err = aicommit.GenerateCommitMessage(ctx, cfg, diff)
+		if err != nil {
+			return err
+		}
+		aicommit.StoreMessage(cfg, diff, msg)
+		aicommit.LogUsage(cfg, usage)
 	}
-
+	subject, _, _ := strings.Cut(strings.TrimSpace(msg), "\n")
+	fmt.Println(strings.TrimSpace(subject))
 	return nil
 }
 
-// runShow generates a commit message from the staged diff and prints it to stdout.
-// Unlike the hook path, errors are fatal — the user is explicitly asking for output.
-func runShow(args []string) error {
+// runLint checks an existing commit message, from a file or stdin, against
+// the configured conventions. Each problem is printed to stderr and the
+// command fails, so it can run from a commit-msg hook.
+func runLint(args []string) error {
 	useStdin := false
-	for _, a := range args {
-		switch a {
+	file := ""
+	ov := aicommit.Overrides{Offline: true}
+	for i := 0; i < len(args); i++ {
+		var err error
+		switch args[i] {
 		case "--stdin":
 			useStdin = true
+		case "--profile":
+			ov.Profile, err = flagValue(args, &i)
 		default:
-			return fmt.Errorf("unknown flag: %s", a)
+			if strings.HasPrefix(args[i], "-") || file != "" {
+				return fmt.Errorf("unknown flag: %s", args[i])
+			}
+			file = args[i]
+		}
+		if err != nil {
+			return err
 		}
 	}
+	if useStdin == (file != "") {
+		return errors.New("lint needs a message file or --stdin")
+	}
 
-	cfg, err := readConfig()
+	cfg, err := aicommit.ReadConfig(ov)
 	if err != nil {
 		return err
 	}
-
-	var diff string
+	var b []byte
 	if useStdin {
-		b, err := io.ReadAll(os.Stdin)
-		if err != nil {
-			return fmt.Errorf("read stdin: %w", err)
-		}
-		diff = string(b)
+		b, err = io.ReadAll(os.Stdin)
 	} else {
-		diff, err = getStagedDiff(cfg.MaxDiffBytes)
-		if err != nil {
-			return err
-		}
+		b, err = os.ReadFile(file)
 	}
-
-	if strings.TrimSpace(diff) == "" {
-		return errors.New("no diff content — either stage some changes or pipe a diff via --stdin")
+	if err != nil {
+		return fmt.Errorf("read message: %w", err)
 	}
 
-	prompt := buildPrompt(diff)
-
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.TimeoutSeconds)*time.Second)
-	defer cancel()
-
-	fmt.Fprintf(os.Stderr, "Querying %s (%s)...\n", cfg.Endpoint, cfg.Model)
-
-	msg, err := callChatCompletions(ctx, cfg, prompt)
-	if err != nil {
-		return err
+	problems := aicommit.LintMessage(cfg, string(b), aicommit.GitCommentChar())
+	for _, p := range problems {
+		fmt.Fprintf(os.Stderr, "git-ai-commit: lint: %s\n", p)
 	}
-	msg = sanitizeCommitMessage(msg)
-	if msg == "" {
-		return errors.New("LLM returned empty commit message")
+	if len(problems) > 0 {
+		return fmt.Errorf("commit message has %d problem(s)", len(problems))
 	}
+	return nil
+}
 
-	fmt.Print(msg)
+// runCommitMsg is the commit-msg hook installed by install --with-lint: it
+// lints the message file Git passes (flags such as --profile may be added to
+// the script by hand) and fails on any problem, which aborts the commit.
+func runCommitMsg(args []string) error {
+	if err := runLint(args); err != nil {
+		return fmt.Errorf("%w (use git commit --no-verify to skip this check)", err)
+	}
 	return nil
 }
 
-func runPrepareCommitMsg(args []string) error {
-	if len(args) < 1 {
-		return errors.New("prepare-commit-msg requires <commit-msg-file>")
+// warnTruncated tells the user when diff was cut to ai-commit.maxDiffBytes,
+// since the message then describes only part of the changes.
+func warnTruncated(cfg aicommit.Config, diff string) {
+	n := aicommit.TruncatedBytes(diff)
+	if n == 0 {
+		return
 	}
-	msgFile := args[0]
-	source := ""
-	if len(args) >= 2 {
-		source = args[1]
+	hint := "raise ai-commit.maxDiffBytes to send more"
+	if !cfg.Chunked {
+		hint += ", or set ai-commit.chunked to send all of it, summarized in parts"
 	}
+	fmt.Fprintf(os.Stderr, "git-ai-commit: warning: the diff was truncated to %d bytes; %d bytes (%d%%) were not sent — %s\n",
+		cfg.MaxDiffBytes, n, n*100/(n+cfg.MaxDiffBytes), hint)
+}
 
-	// Common skip cases:
-	// - merge/squash: Git is constructing special commit messages.
-	if source == "merge" || source == "squash" {
-		return nil
+// errInterrupted is returned by show when the user presses Ctrl-C while the
+// request is in flight.
+var errInterrupted = errors.New("cancelled")
+
+// startProgress shows a spinner with the elapsed time on stderr while a
+// request is in flight and returns a function that stops and erases it. It
+// does nothing unless stderr is a terminal, and stays out of the way of
+// --verbose logging.
+func startProgress(timeout time.Duration) (stop func()) {
+	if aicommit.Verbose || !isTerminal(os.Stderr) {
+		return func() {}
+	}
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		start := time.Now()
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		frames := `|/-\`
+		drawn := false
+		for n := 0; ; n++ {
+			select {
+			case <-done:
+				if drawn {
+					fmt.Fprint(os.Stderr, "\r\033[K")
+				}
+				return
+			case <-ticker.C:
+				// Quick responses finish without any flicker.
+				if time.Since(start) < time.Second {
+					continue
+				}
+				fmt.Fprintf(os.Stderr, "\r\033[K%c waiting for the model... %ds (timeout %ds)",
+					frames[n%len(frames)], int(time.Since(start).Seconds()), int(timeout.Seconds()))
+				drawn = true
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-finished
 	}
+}
 
-	// If the message file already has meaningful content (e.g. -m, template already filled),
-	// do nothing.
-	existing, err := os.ReadFile(msgFile)
+// isTerminal reports whether f is a character device such as a terminal,
+// rather than a pipe or file.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// confirmSend asks before the diff goes to a hosted endpoint when
+// ai-commit.confirmRemote is set.
+func confirmSend(cfg aicommit.Config) error {
+	if !cfg.ConfirmRemote || aicommit.IsLocalEndpoint(cfg.Endpoint) {
+		return nil
+	}
+	ok, err := confirm(fmt.Sprintf("Send the diff to %s?", aicommit.EndpointHost(cfg.Endpoint)))
 	if err != nil {
-		return fmt.Errorf("read commit message file: %w", err)
+		return fmt.Errorf("ai-commit.confirmRemote is set but there is no terminal to confirm on: %w", err)
 	}
-	if hasNonCommentContent(string(existing)) {
-		return nil
+	if !ok {
+		return errors.New("not sending the diff")
 	}
+	return nil
+}
 
-	cfg, err := readConfig()
-	if err != nil {
-		return err
+// runPR prints a Markdown pull request description for the commits on the
+// current branch that are not on the base branch.
+func runPR(args []string) error {
+	base := ""
+	var ov aicommit.Overrides
+	for i := 0; i < len(args); i++ {
+		var err error
+		switch args[i] {
+		case "--base":
+			base, err = flagValue(args, &i)
+		case "--profile":
+			ov.Profile, err = flagValue(args, &i)
+		case "--model":
+			ov.Model, err = flagValue(args, &i)
+		case "--endpoint":
+			ov.Endpoint, err = flagValue(args, &i)
+		case "--verbose":
+			aicommit.Verbose = true
+		default:
+			return fmt.Errorf("unknown flag: %s", args[i])
+		}
+		if err != nil {
+			return err
+		}
 	}
 
-	diff, err := getStagedDiff(cfg.MaxDiffBytes)
+	cfg, err := aicommit.ReadConfig(ov)
 	if err != nil {
 		return err
 	}
-	if strings.TrimSpace(diff) == "" {
-		return nil
+	if base == "" {
+		base = cfg.BaseBranch
 	}
 
-	prompt := buildPrompt(diff)
-
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.TimeoutSeconds)*time.Second)
-	defer cancel()
-
-	msg, err := callChatCompletions(ctx, cfg, prompt)
+	mergeBase, err := aicommit.BranchMergeBase(base)
 	if err != nil {
 		return err
 	}
-	msg = sanitizeCommitMessage(msg)
-	if msg == "" {
-		return errors.New("LLM returned empty commit message")
-	}
-
-	// Preserve any existing content (likely Git comments/instructions).
-	// Since we've verified there's no meaningful content, we can safely place our message on top.
-	newBody := msg
-	if !strings.HasSuffix(newBody, "\n") {
-		newBody += "\n"
+	commits, err := aicommit.GitOutput("log", "--no-merges", "--reverse", "--pretty=format:- %s", mergeBase+"..HEAD")
+	if err != nil {
+		return err
 	}
-	// Ensure one blank line before any existing comment block (if present).
-	if strings.TrimSpace(string(existing)) != "" {
-		if !strings.HasSuffix(newBody, "\n\n") {
-			newBody += "\n"
-		}
-		newBody += string(existing)
+	if strings.TrimSpace(commits) == "" {
+		return fmt.Errorf("no commits on the current branch since it forked from %s", base)
 	}
-
-	if err := os.WriteFile(msgFile, []byte(newBody), 0o644); err != nil {
-		return fmt.Errorf("write commit message file: %w", err)
+	// The description is written in one request, so chunked mode doesn't
+	// lift the size limit here.
+	cfg.Chunked = false
+	diff, err := aicommit.RangeDiff(cfg, mergeBase, "HEAD")
+	if err != nil {
+		return err
 	}
-	return nil
-}
+	warnTruncated(cfg, diff)
+	diff = aicommit.RedactDiff(cfg, diff)
 
-func readConfig() (config, error) {
-	cfg := config{
-		Endpoint:       "https://api.openai.com/v1",
-		Model:          "gpt-5-nano",
-		MaxDiffBytes:   200_000,
-		TimeoutSeconds: 30,
+	if err := confirmSend(cfg); err != nil {
+		return err
 	}
 
-	if v, ok := gitConfigGet("ai-commit.endpoint"); ok && strings.TrimSpace(v) != "" {
-		cfg.Endpoint = strings.TrimSpace(v)
-	}
-	if v, ok := gitConfigGet("ai-commit.model"); ok {
-		cfg.Model = strings.TrimSpace(v)
-	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.TimeoutSeconds)*time.Second)
+	defer cancel()
 
-	if cfg.Endpoint == "" {
-		return cfg, errors.New("missing git config: ai-commit.endpoint (set to base URL, e.g. https://api.openai.com/v1)")
+	fmt.Fprintf(os.Stderr, "Querying %s (%s)...\n", cfg.Endpoint, cfg.Model)
+	body, usage, err := aicommit.CallChatCompletions(ctx, cfg, aicommit.BuildPRPrompt(cfg, commits, diff))
+	if err != nil {
+		return err
 	}
-	if cfg.Model == "" {
-		// local endpoints may be ok with no model provided...
+	body = aicommit.SanitizeCommitMessage(body)
+	if cfg.StripDisclaimers {
+		body = aicommit.StripTrailingDisclaimers(body, cfg.DisclaimerPatterns)
 	}
-
-	// Normalise: resolve to the canonical /chat/completions URL,
-	// handling any combination of trailing slashes, existing /v1, etc.
-	// We do this before resolving the API key so that git-credentials can use
-	// the normalised endpoint URL.
-	resolved, err := ResolveChatCompletionsEndpoint(cfg.Endpoint)
-	if err != nil {
-		return cfg, fmt.Errorf("invalid ai-commit.endpoint %q: %w", cfg.Endpoint, err)
+	if strings.TrimSpace(body) == "" {
+		return errors.New("LLM returned empty content")
 	}
-	cfg.Endpoint = resolved
+	reportUsage(cfg, usage)
 
-	// Resolve the API key — may be a literal value, an env-var reference, or
-	// the special token "git-credentials".
-	if rawKey, ok := gitConfigGet("ai-commit.apiKey"); ok {
-		key, err := resolveAPIKey(strings.TrimSpace(rawKey), cfg.Endpoint)
+	if cfg.PRIncludeStat {
+		stat, err := aicommit.GitOutput("diff", "--stat", "--no-color", mergeBase+"..HEAD")
 		if err != nil {
-			return cfg, fmt.Errorf("ai-commit.apiKey: %w", err)
+			return err
 		}
-		cfg.APIKey = key
+		body += "\n<details><summary>Diff stat</summary>\n\n```\n" + strings.TrimRight(stat, "\n") + "\n```\n\n</details>\n"
 	}
-	// If ai-commit.apiKey is not set at all we leave cfg.APIKey empty;
-	// local endpoints (Ollama, LM Studio) work fine without one.
+	fmt.Print(body)
+	return nil
+}
 
-	if v, ok := gitConfigGet("ai-commit.maxDiffBytes"); ok {
-		if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && n > 0 {
-			cfg.MaxDiffBytes = n
+// runNotes prints release notes for the commits in from..to.
+func runNotes(args []string) error {
+	from, to := "", "HEAD"
+	var ov aicommit.Overrides
+	for i := 0; i < len(args); i++ {
+		var err error
+		switch args[i] {
+		case "--from":
+			from, err = flagValue(args, &i)
+		case "--to":
+			to, err = flagValue(args, &i)
+		case "--profile":
+			ov.Profile, err = flagValue(args, &i)
+		case "--model":
+			ov.Model, err = flagValue(args, &i)
+		case "--endpoint":
+			ov.Endpoint, err = flagValue(args, &i)
+		case "--verbose":
+			aicommit.Verbose = true
+		default:
+			return fmt.Errorf("unknown flag: %s", args[i])
 		}
-	}
-	if v, ok := gitConfigGet("ai-commit.timeoutSeconds"); ok {
-		if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && n > 0 {
-			cfg.TimeoutSeconds = n
+		if err != nil {
+			return err
 		}
 	}
-
-	return cfg, nil
-}
-
-// resolveAPIKey resolves the raw value of ai-commit.apiKey into an actual key
-// string. Three forms are supported:
-//
-//  1. Literal — any value that does not match the forms below is returned as-is.
-//  2. Env-var — a value starting with "$" is treated as an environment-variable
-//     name; the variable is read at runtime.
-//     Example config value: $OPENAI_API_KEY
-//  3. git-credentials — the exact string "git-credentials" (case-insensitive)
-//     causes the git credential helper to be queried using the protocol and
-//     host extracted from endpoint; the returned password is used as the key.
-func resolveAPIKey(raw, endpoint string) (string, error) {
-	if raw == "" {
-		return "", nil
+	if from == "" {
+		return errors.New("notes requires --from <rev>, e.g. --from v1.0.0")
 	}
 
-	// Form 2: environment variable reference.
-	if strings.HasPrefix(raw, "$") {
-		varName := raw[1:]
-		if varName == "" {
-			return "", errors.New("environment variable name must not be empty (got bare \"$\")")
-		}
-		val := os.Getenv(varName)
-		if val == "" {
-			return "", fmt.Errorf("environment variable %q is not set or is empty", varName)
-		}
-		return val, nil
+	cfg, err := aicommit.ReadConfig(ov)
+	if err != nil {
+		return err
 	}
-
-	// Form 3: git credential helper.
-	if strings.EqualFold(raw, "git-credentials") {
-		return resolveAPIKeyFromGitCredentials(endpoint)
+	for _, rev := range []string{from, to} {
+		if err := aicommit.VerifyRevision(rev); err != nil {
+			return err
+		}
 	}
-
-	// Form 1: literal value.
-	return raw, nil
-}
-
-// resolveAPIKeyFromGitCredentials asks the configured git credential helper for
-// the password associated with the host of endpoint, then returns it as the API
-// key. It shells out to `git credential fill`, which consults the same helpers
-// that Git itself uses (macOS Keychain, Windows Credential Manager, libsecret,
-// pass, etc.).
-//
-// The "username" field in the credential request is set to "api-key" as a
-// conventional label; most helpers store credentials by (protocol, host,
-// username) so this keeps LLM keys separate from any Git hosting credentials
-// that may share the same hostname.
-func resolveAPIKeyFromGitCredentials(endpoint string) (string, error) {
-	u, err := url.Parse(endpoint)
+	changes, err := aicommit.RangeSummary(from, to)
 	if err != nil {
-		return "", fmt.Errorf("cannot parse endpoint URL for git-credentials lookup: %w", err)
+		return err
 	}
-
-	protocol := u.Scheme
-	host := u.Hostname()
-	port := u.Port()
-
-	if protocol == "" || host == "" {
-		return "", fmt.Errorf("endpoint %q has no scheme or host; cannot query git credential helper", endpoint)
+	if changes == "" {
+		return fmt.Errorf("no commits between %s and %s", from, to)
 	}
+	changes = aicommit.TruncateDiff(changes, cfg.MaxDiffBytes)
+	warnTruncated(cfg, changes)
+	changes = aicommit.RedactDiff(cfg, changes)
 
-	// Build the input for `git credential fill`.
-	// Format: key=value pairs, one per line, terminated by a blank line.
-	var input strings.Builder
-	fmt.Fprintf(&input, "protocol=%s\n", protocol)
-	fmt.Fprintf(&input, "host=%s\n", host)
-	if port != "" {
-		fmt.Fprintf(&input, "host=%s:%s\n", host, port) // some helpers want host:port
+	if err := confirmSend(cfg); err != nil {
+		return err
 	}
-	fmt.Fprintf(&input, "username=api-key\n")
-	fmt.Fprintf(&input, "\n")
 
-	cmd := exec.Command("git", "credential", "fill")
-	cmd.Stdin = strings.NewReader(input.String())
-	var out bytes.Buffer
-	var errBuf bytes.Buffer
-	cmd.Stdout = &out
-	cmd.Stderr = &errBuf
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.TimeoutSeconds)*time.Second)
+	defer cancel()
 
-	if err := cmd.Run(); err != nil {
-		stderr := strings.TrimSpace(errBuf.String())
-		if stderr != "" {
-			return "", fmt.Errorf("git credential fill failed: %w: %s", err, stderr)
-		}
-		return "", fmt.Errorf("git credential fill failed: %w", err)
+	fmt.Fprintf(os.Stderr, "Querying %s (%s)...\n", cfg.Endpoint, cfg.Model)
+	notes, usage, err := aicommit.CallChatCompletions(ctx, cfg, aicommit.BuildNotesPrompt(cfg, from, to, changes))
+	if err != nil {
+		return err
 	}
-
-	// Parse the output: lines of "key=value".
-	password := ""
-	for _, line := range strings.Split(out.String(), "\n") {
-		line = strings.TrimSpace(line)
-		if strings.HasPrefix(line, "password=") {
-			password = strings.TrimPrefix(line, "password=")
-			break
-		}
+	notes = aicommit.SanitizeCommitMessage(notes)
+	if cfg.StripDisclaimers {
+		notes = aicommit.StripTrailingDisclaimers(notes, cfg.DisclaimerPatterns)
 	}
-
-	if password == "" {
-		return "", fmt.Errorf(
-			"git credential fill returned no password for protocol=%s host=%s username=api-key\n"+
-				"Store the key with: git credential approve  (or use your system keychain tool)",
-			protocol, host,
-		)
+	if strings.TrimSpace(notes) == "" {
+		return errors.New("LLM returned empty content")
 	}
-
-	return password, nil
+	reportUsage(cfg, usage)
+	fmt.Print(notes)
+	return nil
 }
 
-func gitConfigGet(key string) (string, bool) {
-	// Uses the effective config (system + global + local), which is usually what you want.
-	// If the key is unset, git exits non-zero; we treat that as "not found".
-	cmd := exec.Command("git", "config", "--get", key)
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	cmd.Stderr = io.Discard
-	if err := cmd.Run(); err != nil {
-		return "", false
+// reportUsage prints the token counts of a request to stderr and appends them
+// to ai-commit.usageLog. Nothing is printed when the provider reported none.
+func reportUsage(cfg aicommit.Config, usage aicommit.Usage) {
+	if usage.TotalTokens > 0 {
+		fmt.Fprintf(os.Stderr, "Tokens: %d prompt + %d completion = %d total\n",
+			usage.PromptTokens, usage.CompletionTokens, usage.TotalTokens)
+		if cost, ok := aicommit.EstimateCost(cfg, usage); ok {
+			fmt.Fprintf(os.Stderr, "Estimated cost: %s\n", aicommit.FormatCost(cost))
+		}
 	}
-	return strings.TrimRight(out.String(), "\n"), true
+	aicommit.LogUsage(cfg, usage)
 }
 
-func getStagedDiff(maxBytes int) (string, error) {
-	// Staged diff only, and disable color/ext diff to keep prompts clean and deterministic.
-	cmd := exec.Command("git", "diff", "--cached", "--no-color", "--no-ext-diff")
-	var out bytes.Buffer
-	var errBuf bytes.Buffer
-	cmd.Stdout = &out
-	cmd.Stderr = &errBuf
-	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("git diff --cached failed: %v: %s", err, strings.TrimSpace(errBuf.String()))
-	}
+// showOutput is the JSON shape printed by `show --format json`.
+type showOutput struct {
+	Subject string          `json:"subject"`
+	Body    string          `json:"body"`
+	Raw     string          `json:"raw"`
+	Short   string          `json:"short,omitempty"` // only with --both
+	Usage   *aicommit.Usage `json:"usage,omitempty"` // absent for cached messages
+}
 
-	b := out.Bytes()
-	if maxBytes > 0 && len(b) > maxBytes {
-		// Truncate safely. Add a marker so the model knows it's incomplete.
-		trunc := b[:maxBytes]
-		return string(trunc) + "\n\n[diff truncated]\n", nil
+// printShowMessage adds the configured trailers to a cleaned message and
+// writes it to w as plain text or, for format "json", as a showOutput object.
+func printShowMessage(w io.Writer, cfg aicommit.Config, msg, short string, usage *aicommit.Usage, format string) error {
+	msg = aicommit.AddCoAuthors(cfg, msg, "")
+	if cfg.MarkerTrailer {
+		msg = aicommit.AddMarker(cfg, msg)
+	}
+	if cfg.StripMarker {
+		msg = aicommit.StripMarker(msg)
 	}
-	return string(b), nil
+	if format != "json" {
+		_, err := io.WriteString(w, msg)
+		return err
+	}
+
+	raw := strings.TrimSpace(msg)
+	subject, body, _ := strings.Cut(raw, "\n\n")
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return enc.Encode(showOutput{
+		Subject: strings.TrimSpace(subject),
+		Body:    strings.TrimSpace(body),
+		Raw:     raw,
+		Short:   short,
+		Usage:   usage,
+	})
 }
 
-func buildPrompt(diff string) string {
-	// Keep prompt simple and instruction-focused.
-	return strings.TrimSpace(fmt.Sprintf(`
-You are an expert software engineer. Write a Git commit message for the following staged diff.
+// failClosedError wraps a prepare-commit-msg error that must abort the
+// commit because ai-commit.failOpen is false.
+type failClosedError struct{ err error }
 
-Requirements:
-- Output plain text only.
-- First line: a concise subject following the Conventional Commits format, max 72 characters.
-  The subject must start with one of these types followed by a colon and a space:
-    feat:     a new feature
-    fix:      a bug fix
-    docs:     documentation changes only
-    style:    formatting, whitespace — no logic change
-    refactor: code restructured without adding features or fixing bugs
-    perf:     performance improvement
-    test:     adding or updating tests
-    chore:    build process, tooling, dependency updates, CI config
-  Use a scope in parentheses when it helps clarity, e.g. "feat(auth): add OAuth2 login".
-  Write the description in imperative mood, e.g. "feat: add retry logic" not "feat: added retry logic".
-- Then a blank line.
-- Then 3-7 bullet points ("- ") summarizing key changes.
-- Mention user-visible behavior changes and important refactors.
-- Do not include code fences.
-- Do not use emoji anywhere in the output.
-- Do not use any quotation marks (single, double, or backticks) in the output.
-- Do not use backslashes or any other escape characters in the output.
-- The output must be safe to copy and paste directly into a terminal without any shell interpretation issues.
+func (e *failClosedError) Error() string { return e.err.Error() }
 
-Staged diff:
-%s
-`, diff))
-}
+func (e *failClosedError) Unwrap() error { return e.err }
 
-type chatCompletionsRequest struct {
-	Model    string    `json:"model"`
-	Messages []message `json:"messages"`
-}
+func runPrepareCommitMsg(args []string) (err error) {
+	// Resolve ai-commit.failOpen here rather than from the Config, so that
+	// errors raised before or inside ReadConfig honour it too.
+	var ov aicommit.Overrides
+	defer func() {
+		if err != nil && !aicommit.FailOpen(ov.Profile) {
+			err = &failClosedError{err}
+		}
+	}()
 
-type message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
-}
+	// Flags may be added to the hook script by hand; everything else is
+	// passed positionally by Git.
+	var positional []string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--profile":
+			v, err := flagValue(args, &i)
+			if err != nil {
+				return err
+			}
+			ov.Profile = v
+		case "--model":
+			v, err := flagValue(args, &i)
+			if err != nil {
+				return err
+			}
+			ov.Model = v
+		case "--verbose":
+			aicommit.Verbose = true
+		default:
+			positional = append(positional, args[i])
+		}
+	}
+	args = positional
 
-type chatCompletionsResponse struct {
-	Choices []struct {
-		Message message `json:"message"`
-	} `json:"choices"`
-	Error *struct {
-		Message string `json:"message"`
-		Type    string `json:"type"`
-	} `json:"error,omitempty"`
-}
+	if len(args) < 1 {
+		return errors.New("prepare-commit-msg requires <commit-msg-file>")
+	}
+	msgFile := args[0]
+	source := ""
+	if len(args) >= 2 {
+		source = args[1]
+	}
+
+	// An amend (source "commit" with the amended sha) may regenerate its
+	// message when ai-commit.regenerateOnAmend is set; see IsUneditedMessage.
+	regenerate, _ := aicommit.GitConfigBool("ai-commit.regenerateOnAmend")
+	amend := regenerate && source == "commit" && len(args) >= 3
 
-func callChatCompletions(ctx context.Context, cfg config, prompt string) (string, error) {
-	reqBody := chatCompletionsRequest{
-		Model: cfg.Model,
-		Messages: []message{
-			{Role: "system", Content: "You write concise, high-signal Git commit messages."},
-			{Role: "user", Content: prompt},
-		},
+	// Only generate for the commit sources the user allows. By default that
+	// is a plain `git commit` and a commit template; merge/squash (Git builds
+	// special messages), -m/-F and amends are skipped.
+	if !amend && !hookSourceAllowed(source) {
+		aicommit.Debugf("skipping: commit source %q is not in ai-commit.sources", source)
+		return nil
 	}
 
-	b, err := json.Marshal(reqBody)
+	// If the message file already has meaningful content (e.g. -m, template already filled),
+	// do nothing.
+	content, err := os.ReadFile(msgFile)
 	if err != nil {
-		return "", fmt.Errorf("marshal request: %w", err)
+		return fmt.Errorf("read commit message file: %w", err)
+	}
+	// Work on LF internally and write back with the file's own line endings,
+	// so CRLF files (common on Windows) don't end up with mixed endings.
+	existing := string(content)
+	crlf := usesCRLF(existing)
+	existing = strings.ReplaceAll(existing, "\r\n", "\n")
+	commentChar := aicommit.GitCommentChar()
+	if aicommit.HasNonCommentContent(existing, commentChar) {
+		// With ai-commit.markerTrailer, a message carrying our marker outside
+		// an amend is left over from an earlier run (e.g. a template or
+		// message file it was saved to), even if partly edited: replace it.
+		marked, _ := aicommit.ConfigBool("ai-commit.markerTrailer")
+		switch {
+		case marked && source != "commit" && aicommit.HasMarker(existing, commentChar):
+			aicommit.Debugf("replacing a stale generated message")
+		case amend && aicommit.IsUneditedMessage(existing, commentChar):
+			aicommit.Debugf("regenerating unedited message on amend")
+		default:
+			aicommit.Debugf("skipping: commit message file already has content")
+			// An amended message may still carry a marker from an
+			// earlier commit; drop it if the user asked for that.
+			if strip, _ := aicommit.ConfigBool("ai-commit.stripMarker"); strip && strings.Contains(existing, aicommit.MarkerKey+":") {
+				if err := writeMessageFile(msgFile, aicommit.StripMarker(existing), crlf); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		// The message is ours, so replace it and keep only Git's comment
+		// block.
+		existing = aicommit.CommentLines(existing, commentChar)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", cfg.Endpoint, bytes.NewReader(b))
+	cfg, err := aicommit.ReadConfig(ov)
 	if err != nil {
-		return "", fmt.Errorf("new request: %w", err)
+		return err
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+cfg.APIKey)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	// Wrappers may supply a precomputed diff via GIT_AI_COMMIT_DIFF;
+	// otherwise fall back to the staged diff.
+	diff, fromEnv, err := aicommit.DiffFromEnv(cfg.DiffLimit())
 	if err != nil {
-		return "", fmt.Errorf("LLM request failed: %w", err)
+		return err
 	}
-	defer resp.Body.Close()
+	base := ""
+	if !fromEnv {
+		if amend {
+			// The amended commit is the previous one plus anything newly
+			// staged, so describe everything since its parent.
+			if base, err = aicommit.AmendBase(); err != nil {
+				return err
+			}
+		}
+		diff, err = aicommit.StagedDiffFrom(cfg, base)
+		if err != nil {
+			return err
+		}
+	}
+	if strings.TrimSpace(diff) == "" {
+		aicommit.Debugf("skipping: staged diff is empty")
+		return nil
+	}
+	// A warning would scroll past during git commit; mention it only
+	// when asked for verbose output.
+	if n := aicommit.TruncatedBytes(diff); n > 0 {
+		aicommit.Debugf("diff truncated to ai-commit.maxDiffBytes=%d; %d bytes were not sent", cfg.MaxDiffBytes, n)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.TimeoutSeconds)*time.Second)
+	defer cancel()
 
-	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<20)) // cap 4MB
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		// Try to parse error shape; fall back to raw body.
-		var parsed chatCompletionsResponse
-		if json.Unmarshal(body, &parsed) == nil && parsed.Error != nil && parsed.Error.Message != "" {
-			return "", fmt.Errorf("LLM HTTP %d: %s", resp.StatusCode, parsed.Error.Message)
+	msg, ok := aicommit.CachedMessage(cfg, diff)
+	switch {
+	case !fromEnv && whitespaceOnly(cfg, base):
+		aicommit.Debugf("staged changes are whitespace only; not asking the model")
+		msg = aicommit.WhitespaceOnlyMessage(cfg)
+	case ok:
+		aicommit.Debugf("using cached message")
+	default:
+		// A hook can't stop for a question, so confirmRemote means the hook
+		// never sends the diff to a remote endpoint.
+		if cfg.ConfirmRemote && !aicommit.IsLocalEndpoint(cfg.Endpoint) {
+			fmt.Fprintf(os.Stderr, "git-ai-commit: ai-commit.confirmRemote is set; not sending the diff to %s from the hook (use git-ai-commit show)\n", aicommit.EndpointHost(cfg.Endpoint))
+			return nil
+		}
+		var usage aicommit.Usage
+		msg, usage, err = aicommit.GenerateCommitMessage(ctx, cfg, diff)
+		switch {
+		case err == nil:
+			aicommit.StoreMessage(cfg, diff, msg)
+			aicommit.LogUsage(cfg, usage)
+		case cfg.Fallback == "filelist":
+			// Offline or provider down: a file list is still a better
+			// starting point than an empty editor.
+			fallback, ferr := aicommit.FileListMessage(cfg)
+			if ferr != nil || fallback == "" {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "git-ai-commit: warning: %v; using a file list instead\n", err)
+			msg = fallback
+		default:
+			return err
 		}
-		return "", fmt.Errorf("LLM HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
 	}
 
-	var parsed chatCompletionsResponse
-	if err := json.Unmarshal(body, &parsed); err != nil {
-		return "", fmt.Errorf("parse response: %w (body: %s)", err, strings.TrimSpace(string(body)))
+	// Preserve any existing content (likely Git comments/instructions).
+	// Since we've verified there's no meaningful content, we can safely place our message on top.
+	// Our message must not start any line with the comment character, or Git
+	// would strip it on commit.
+	msg = aicommit.EscapeCommentLines(aicommit.AddCoAuthors(cfg, msg, existing), commentChar)
+	if regenerate || cfg.MarkerTrailer {
+		msg = aicommit.AddMarker(cfg, msg)
+	}
+	newBody := msg
+	if !strings.HasSuffix(newBody, "\n") {
+		newBody += "\n"
 	}
-	if parsed.Error != nil && parsed.Error.Message != "" {
-		return "", fmt.Errorf("LLM error: %s", parsed.Error.Message)
+	// Ensure one blank line before any existing comment block (if present).
+	if strings.TrimSpace(existing) != "" {
+		if !strings.HasSuffix(newBody, "\n\n") {
+			newBody += "\n"
+		}
+		newBody += existing
 	}
-	if len(parsed.Choices) == 0 {
-		return "", errors.New("LLM response missing choices")
+	if cfg.StripMarker {
+		newBody = aicommit.StripMarker(newBody)
 	}
 
-	return parsed.Choices[0].Message.Content, nil
+	return writeMessageFile(msgFile, newBody, crlf)
 }
 
-func sanitizeCommitMessage(s string) string {
-	s = strings.ReplaceAll(s, "\r\n", "\n")
-	s = strings.TrimSpace(s)
-
-	// Some models might return surrounding quotes; strip common cases.
-	s = strings.TrimPrefix(s, "```")
-	s = strings.TrimSuffix(s, "```")
-	s = strings.TrimSpace(s)
+// usesCRLF reports whether most line breaks in s are CRLF.
+func usesCRLF(s string) bool {
+	crlf := strings.Count(s, "\r\n")
+	return crlf > 0 && crlf >= strings.Count(s, "\n")-crlf
+}
 
-	// Ensure it ends with a newline (Git is fine either way, but this is tidy).
-	if s != "" && !strings.HasSuffix(s, "\n") {
-		s += "\n"
+// writeMessageFile writes an LF-terminated message to the commit message
+// file, converting line endings to CRLF if crlf is set.
+func writeMessageFile(path, msg string, crlf bool) error {
+	if crlf {
+		msg = strings.ReplaceAll(msg, "\n", "\r\n")
 	}
-	return s
+	if err := os.WriteFile(path, []byte(msg), 0o644); err != nil {
+		return fmt.Errorf("write commit message file: %w", err)
+	}
+	return nil
 }
 
-func hasNonCommentContent(commitMsg string) bool {
-	commitMsg = strings.ReplaceAll(commitMsg, "\r\n", "\n")
-	for _, line := range strings.Split(commitMsg, "\n") {
-		trim := strings.TrimSpace(line)
-		if trim == "" {
-			continue
+// defaultHookSources are the prepare-commit-msg sources generation runs for
+// when ai-commit.sources is unset; "none" stands for the empty source.
+var defaultHookSources = []string{"none", "template"}
+
+// hookSourceAllowed reports whether the hook should run for the given
+// prepare-commit-msg source (message, template, merge, squash, commit, or ""
+// for none), according to the comma-separated ai-commit.sources allowlist.
+// It is read directly from git config so skipped commits stay cheap.
+func hookSourceAllowed(source string) bool {
+	allowed := defaultHookSources
+	if v, ok := aicommit.GitConfigGet("ai-commit.sources"); ok && strings.TrimSpace(v) != "" {
+		allowed = aicommit.SplitList(v)
+	}
+	if source == "" {
+		source = "none"
+	}
+	for _, a := range allowed {
+		if strings.EqualFold(a, source) {
+			return true
 		}
-		if strings.HasPrefix(trim, "#") {
-			continue
-		}
-		return true
 	}
 	return false
 }
 
-func fatalf(code int, format string, args ...any) {
-	fmt.Fprintf(os.Stderr, "git-ai-commit: "+format+"\n", args...)
-	os.Exit(code)
-}
-
-func ResolveChatCompletionsEndpoint(raw string) (string, error) {
-	if raw == "" {
-		return "", nil
-	}
-
-	u, err := url.Parse(raw)
+// confirm asks a yes/no question on the controlling terminal, which works
+// even when stdin carries a diff. It returns an error when there is no
+// terminal to ask on.
+func confirm(question string) (bool, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
 	if err != nil {
-		return "", err
+		return false, err
 	}
-
-	// Normalize path
-	cleanPath := path.Clean("/" + strings.TrimPrefix(u.Path, "/"))
-
-	// Remove existing /chat/completions if already present
-	cleanPath = strings.TrimSuffix(cleanPath, "/chat/completions")
-
-	// Ensure we have /v1
-	if !strings.HasSuffix(cleanPath, "/v1") {
-		cleanPath = path.Join(cleanPath, "v1")
+	defer tty.Close()
+	fmt.Fprintf(tty, "%s [y/N] ", question)
+	answer, err := bufio.NewReader(tty).ReadString('\n')
+	if err != nil && answer == "" {
+		return false, err
 	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
 
-	// Append final path
-	cleanPath = path.Join(cleanPath, "chat", "completions")
-
-	u.Path = cleanPath
-	u.RawQuery = "" // Defensive: remove accidental query params
+// flagValue returns the value following the flag at args[*i] and advances *i
+// past it.
+func flagValue(args []string, i *int) (string, error) {
+	flag := args[*i]
+	*i++
+	if *i >= len(args) {
+		return "", fmt.Errorf("%s requires a value", flag)
+	}
+	return args[*i], nil
+}
 
-	return u.String(), nil
+func fatalf(code int, format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "git-ai-commit: "+format+"\n", args...)
+	os.Exit(code)
 }
@@ -0,0 +1,580 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/skkdevcraft/git-ai-commit/aicommit"
+)
+
+// isolateGit points git's global configuration and $HOME at a temporary
+// directory and makes another temporary directory the working directory, so
+// tests neither read nor change the user's setup. It returns the home
+// directory.
+func isolateGit(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Chdir(t.TempDir())
+	t.Setenv("HOME", home)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("GIT_CONFIG_GLOBAL", filepath.Join(home, ".gitconfig"))
+	for _, v := range []string{"GIT_CONFIG_COUNT", "GIT_DIR", "GIT_WORK_TREE", "GIT_INDEX_FILE",
+		"AI_COMMIT_ENDPOINT", "AI_COMMIT_MODEL", "AI_COMMIT_API_KEY", "AI_COMMIT_PROFILE", "AI_COMMIT_FAIL_OPEN"} {
+		t.Setenv(v, "") // restores the variable after the test
+		os.Unsetenv(v)
+	}
+	for _, v := range []string{"GIT_AUTHOR_NAME", "GIT_COMMITTER_NAME"} {
+		t.Setenv(v, "Test")
+	}
+	for _, v := range []string{"GIT_AUTHOR_EMAIL", "GIT_COMMITTER_EMAIL"} {
+		t.Setenv(v, "test@example.com")
+	}
+	return home
+}
+
+// runGit runs git in the working directory and returns its trimmed output,
+// failing the test on error.
+func runGit(t *testing.T, args ...string) string {
+	t.Helper()
+	out, err := exec.Command("git", args...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// captureStdout runs f and returns what it printed to standard output.
+func captureStdout(t *testing.T, f func() error) (string, error) {
+	t.Helper()
+	return captureOutput(t, &os.Stdout, f)
+}
+
+// captureStderr runs f and returns what it printed to standard error.
+func captureStderr(t *testing.T, f func() error) (string, error) {
+	t.Helper()
+	return captureOutput(t, &os.Stderr, f)
+}
+
+// captureOutput runs f with *file replaced by a pipe and returns what f
+// wrote to it.
+func captureOutput(t *testing.T, file **os.File, f func() error) (string, error) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := *file
+	*file = w
+	done := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		done <- string(b)
+	}()
+	ferr := f()
+	*file = saved
+	w.Close()
+	return <-done, ferr
+}
+
+func TestUsesCRLF(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want bool
+	}{
+		{"empty", "", false},
+		{"lf only", "# Please enter the commit message\n#\n# On branch main\n", false},
+		{"crlf only", "# Please enter the commit message\r\n#\r\n# On branch main\r\n", true},
+		{"mostly crlf", "subject\r\n\r\n# comment\r\n# tail\n", true},
+		{"even split", "a\r\nb\n", true},
+		{"mostly lf", "subject\n\n# comment\n# tail\r\n", false},
+		{"no newline", "subject", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := usesCRLF(tt.in); got != tt.want {
+				t.Errorf("usesCRLF(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteMessageFile(t *testing.T) {
+	const msg = "fix: handle nil body\n\n- check the body before reading\n\n# comment\n"
+	tests := []struct {
+		name     string
+		existing string
+		want     string
+	}{
+		{"lf file", "# comment\n", msg},
+		{"crlf file", "# comment\r\n#\r\n", "fix: handle nil body\r\n\r\n- check the body before reading\r\n\r\n# comment\r\n"},
+		{"mixed file, mostly crlf", "# a\r\n# b\r\n# c\n", "fix: handle nil body\r\n\r\n- check the body before reading\r\n\r\n# comment\r\n"},
+		{"mixed file, mostly lf", "# a\n# b\n# c\r\n", msg},
+		{"empty file", "", msg},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "COMMIT_EDITMSG")
+			if err := writeMessageFile(path, msg, usesCRLF(tt.existing)); err != nil {
+				t.Fatal(err)
+			}
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("file = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrepareCommitMsgKeepsCRLF(t *testing.T) {
+	msgFile, requests := hookRepo(t, "feat: add main package\n\n- add the entry point")
+	const comments = "# Please enter the commit message for your changes.\r\n#\r\n# On branch main\r\n"
+	if err := os.WriteFile(msgFile, []byte(comments), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runPrepareCommitMsg([]string{msgFile}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(msgFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Fatalf("%d requests, want 1", n)
+	}
+	if !strings.HasPrefix(string(got), "feat: add main package\r\n") || !strings.HasSuffix(string(got), comments) {
+		t.Errorf("file = %q, want the generated message followed by the comments", got)
+	}
+	if n := strings.Count(string(got), "\n"); n != strings.Count(string(got), "\r\n") {
+		t.Errorf("file has bare LF line endings: %q", got)
+	}
+}
+
+func TestInstallGlobal(t *testing.T) {
+	home := isolateGit(t)
+	templateHooks := filepath.Join(home, ".git-templates", "hooks")
+
+	out, err := captureStdout(t, func() error { return runInstall([]string{"--global", "--with-lint"}) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, hook := range []string{"prepare-commit-msg", "commit-msg"} {
+		content, err := os.ReadFile(filepath.Join(templateHooks, hook))
+		if err != nil {
+			t.Fatalf("%s template hook: %v", hook, err)
+		}
+		if !strings.Contains(string(content), hookLine(hook)) {
+			t.Errorf("%s template hook = %q", hook, content)
+		}
+		if !strings.Contains(out, "rm "+filepath.Join(templateHooks, hook)) {
+			t.Errorf("output does not say how to remove the %s hook:\n%s", hook, out)
+		}
+	}
+	if got := runGit(t, "config", "--global", "init.templateDir"); got != defaultTemplateDir {
+		t.Errorf("init.templateDir = %q, want %q", got, defaultTemplateDir)
+	}
+	if !strings.Contains(out, "set git config --global init.templateDir") || !strings.Contains(out, "git config --global --unset init.templateDir") {
+		t.Errorf("output does not report the config change and its undo:\n%s", out)
+	}
+
+	// A new repository gets the hook from the template.
+	runGit(t, "init", "-q", "repo")
+	if _, err := os.Stat(filepath.Join("repo", ".git", "hooks", "prepare-commit-msg")); err != nil {
+		t.Errorf("git init did not copy the hook: %v", err)
+	}
+
+	// Running it again changes nothing.
+	out, err = captureStdout(t, func() error { return runInstall([]string{"--global"}) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "Changes:\n  none\n") {
+		t.Errorf("second install reported changes:\n%s", out)
+	}
+}
+
+func TestInstallGlobalExistingTemplateDir(t *testing.T) {
+	home := isolateGit(t)
+	templateDir := filepath.Join(home, "templates")
+	runGit(t, "config", "--global", "init.templateDir", templateDir)
+
+	if _, err := captureStdout(t, func() error { return runInstall([]string{"--global"}) }); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(templateDir, "hooks", "prepare-commit-msg")); err != nil {
+		t.Errorf("hook not installed in the configured template directory: %v", err)
+	}
+	if got := runGit(t, "config", "--global", "init.templateDir"); got != templateDir {
+		t.Errorf("init.templateDir changed to %q", got)
+	}
+}
+
+func TestInstallGlobalKeepsForeignHook(t *testing.T) {
+	home := isolateGit(t)
+	hookFile := filepath.Join(home, ".git-templates", "hooks", "prepare-commit-msg")
+	if err := os.MkdirAll(filepath.Dir(hookFile), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(hookFile, []byte("#!/bin/sh\necho mine\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := captureStdout(t, func() error { return runInstall([]string{"--global"}) })
+	if err == nil || !strings.Contains(err.Error(), "was not created by git-ai-commit") {
+		t.Fatalf("error = %v, want a refusal", err)
+	}
+	if content, _ := os.ReadFile(hookFile); string(content) != "#!/bin/sh\necho mine\n" {
+		t.Errorf("foreign hook was changed: %q", content)
+	}
+	if out, err := exec.Command("git", "config", "--global", "init.templateDir").Output(); err == nil {
+		t.Errorf("init.templateDir was set to %q", out)
+	}
+}
+
+func TestWarnTruncated(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  aicommit.Config
+		diff string
+		want string
+	}{
+		{"not truncated", aicommit.Config{MaxDiffBytes: 100}, "diff\n", ""},
+		{
+			"truncated",
+			aicommit.Config{MaxDiffBytes: 100},
+			aicommit.TruncateDiff(strings.Repeat("x", 400), 100),
+			"git-ai-commit: warning: the diff was truncated to 100 bytes; 300 bytes (75%) were not sent — raise ai-commit.maxDiffBytes to send more, or set ai-commit.chunked to send all of it, summarized in parts\n",
+		},
+		{
+			"truncated in chunked mode",
+			aicommit.Config{MaxDiffBytes: 100, Chunked: true},
+			aicommit.TruncateDiff(strings.Repeat("x", 200), 100),
+			"git-ai-commit: warning: the diff was truncated to 100 bytes; 100 bytes (50%) were not sent — raise ai-commit.maxDiffBytes to send more\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _ := captureStderr(t, func() error {
+				warnTruncated(tt.cfg, tt.diff)
+				return nil
+			})
+			if got != tt.want {
+				t.Errorf("warnTruncated printed %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// hookRepo creates a repository with a staged change, configured to send
+// requests to a test server that always answers with reply. It returns the
+// path of a commit message file and a counter of requests received.
+func hookRepo(t *testing.T, reply string) (msgFile string, requests *atomic.Int32) {
+	t.Helper()
+	isolateGit(t)
+	requests = new(atomic.Int32)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"choices": []map[string]any{{"message": map[string]string{"role": "assistant", "content": reply}}},
+		})
+	}))
+	t.Cleanup(srv.Close)
+
+	runGit(t, "init", "-q", "-b", "main")
+	runGit(t, "config", "ai-commit.endpoint", srv.URL)
+	runGit(t, "config", "ai-commit.model", "test-model")
+	runGit(t, "config", "ai-commit.cache", "false")
+	if err := os.WriteFile("main.go", []byte("package main\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, "add", "main.go")
+	return filepath.Join(runGit(t, "rev-parse", "--absolute-git-dir"), "COMMIT_EDITMSG"), requests
+}
+
+func TestPrepareCommitMsgExistingContent(t *testing.T) {
+	const comments = "# Please enter the commit message for your changes.\n#\n# On branch main\n"
+	const stale = "feat: add an old entry point\n\n- edited by hand\n\nX-AI-Commit: test-model; sha=0123456789ab\n"
+	tests := []struct {
+		name         string
+		markers      bool
+		content      string
+		wantRequests int32
+		want         string // "" means the file is unchanged
+	}{
+		{"empty", false, comments, 1, "feat: add main package\n\n" + comments},
+		{"user content", false, "my own message\n\n" + comments, 0, ""},
+		{"user content with markers on", true, "my own message\n\n" + comments, 0, ""},
+		{"stale generated message", true, stale + "\n" + comments, 1, "feat: add main package\n\nX-AI-Commit: test-model; sha="},
+		{"marker with markers off", false, stale + "\n" + comments, 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msgFile, requests := hookRepo(t, "feat: add main package")
+			if tt.markers {
+				runGit(t, "config", "ai-commit.markerTrailer", "true")
+			}
+			if err := os.WriteFile(msgFile, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := runPrepareCommitMsg([]string{msgFile}); err != nil {
+				t.Fatal(err)
+			}
+			got, err := os.ReadFile(msgFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := requests.Load(); n != tt.wantRequests {
+				t.Errorf("%d requests, want %d", n, tt.wantRequests)
+			}
+			switch {
+			case tt.want == "":
+				if string(got) != tt.content {
+					t.Errorf("file changed to %q", got)
+				}
+			case !strings.HasPrefix(string(got), tt.want):
+				t.Errorf("file = %q, want it to start with %q", got, tt.want)
+			case strings.Contains(string(got), "old entry point"):
+				t.Errorf("stale message kept: %q", got)
+			case !strings.HasSuffix(string(got), comments):
+				t.Errorf("comment block lost: %q", got)
+			}
+		})
+	}
+}
+
+func TestInstallFromLinkedWorktree(t *testing.T) {
+	isolateGit(t)
+	runGit(t, "init", "-q", "-b", "main", "repo")
+	t.Chdir("repo")
+	repo, _ := os.Getwd()
+	runGit(t, "commit", "-q", "--allow-empty", "-m", "initial")
+	runGit(t, "worktree", "add", "-q", "-b", "feature", filepath.Join("..", "wt"))
+	t.Chdir(filepath.Join("..", "wt"))
+	worktreeGitDir := runGit(t, "rev-parse", "--absolute-git-dir")
+
+	out, err := captureStdout(t, func() error { return runInstall(nil) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(repo, ".git", "hooks", "prepare-commit-msg")); err != nil {
+		t.Errorf("hook not installed in the common hooks directory: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(worktreeGitDir, "hooks", "prepare-commit-msg")); err == nil {
+		t.Error("hook installed in the worktree's own Git directory")
+	}
+	if !strings.Contains(out, "(shared by all worktrees)") {
+		t.Errorf("output does not mention the shared directory:\n%s", out)
+	}
+
+	// The main worktree sees the hook as installed.
+	t.Chdir(repo)
+	out, err = captureStdout(t, func() error { return runInstall(nil) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "already installed") {
+		t.Errorf("second install from the main worktree:\n%s", out)
+	}
+}
+
+func TestInstallHonoursHooksPath(t *testing.T) {
+	isolateGit(t)
+	runGit(t, "init", "-q", "-b", "main")
+	runGit(t, "config", "core.hooksPath", "githooks")
+
+	if _, err := captureStdout(t, func() error { return runInstall(nil) }); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join("githooks", "prepare-commit-msg")); err != nil {
+		t.Errorf("hook not installed in core.hooksPath: %v", err)
+	}
+}
+
+func TestInstallWithGitDirEnv(t *testing.T) {
+	isolateGit(t)
+	dir, _ := os.Getwd()
+	store := filepath.Join(dir, "store.git")
+	if err := os.Mkdir("work", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, "--git-dir="+store, "--work-tree="+filepath.Join(dir, "work"), "init", "-q", "-b", "main")
+	t.Chdir("work")
+	t.Setenv("GIT_DIR", "../store.git")
+	t.Setenv("GIT_WORK_TREE", ".")
+
+	if _, err := captureStdout(t, func() error { return runInstall(nil) }); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(store, "hooks", "prepare-commit-msg")); err != nil {
+		t.Errorf("hook not installed in $GIT_DIR/hooks: %v", err)
+	}
+}
+
+func TestPrepareCommitMsgWhitespaceOnly(t *testing.T) {
+	for _, skip := range []bool{true, false} {
+		t.Run("skipWhitespaceOnly="+strconv.FormatBool(skip), func(t *testing.T) {
+			msgFile, requests := hookRepo(t, "style: reindent main")
+			runGit(t, "commit", "-q", "-m", "initial")
+			if err := os.WriteFile("main.go", []byte("package  main\n\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			runGit(t, "add", "main.go")
+			if skip {
+				runGit(t, "config", "ai-commit.skipWhitespaceOnly", "true")
+			}
+			if err := os.WriteFile(msgFile, nil, 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := runPrepareCommitMsg([]string{msgFile}); err != nil {
+				t.Fatal(err)
+			}
+			got, _ := os.ReadFile(msgFile)
+			want, wantRequests := "style: reindent main\n", int32(1)
+			if skip {
+				want, wantRequests = "style: formatting changes\n", 0
+			}
+			if string(got) != want {
+				t.Errorf("message = %q, want %q", got, want)
+			}
+			if n := requests.Load(); n != wantRequests {
+				t.Errorf("%d requests, want %d", n, wantRequests)
+			}
+		})
+	}
+}
+
+func TestPrepareCommitMsgFailOpen(t *testing.T) {
+	tests := []struct {
+		name       string
+		failOpen   string // ai-commit.profiles.strict.failOpen; "" leaves it unset
+		flag       bool   // select the profile with --profile instead of ai-commit.profile
+		missing    bool   // fail before ReadConfig by pointing at a missing message file
+		wantClosed bool
+	}{
+		{name: "default"},
+		{name: "profile failOpen=false", failOpen: "false", wantClosed: true},
+		{name: "profile failOpen=true", failOpen: "true"},
+		{name: "profile from flag", failOpen: "false", flag: true, wantClosed: true},
+		{name: "error before ReadConfig", failOpen: "false", missing: true, wantClosed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msgFile, requests := hookRepo(t, "feat: add main package")
+			// An invalid style in the profile makes ReadConfig fail.
+			runGit(t, "config", "ai-commit.profiles.strict.style", "bogus")
+			if tt.failOpen != "" {
+				runGit(t, "config", "ai-commit.profiles.strict.failOpen", tt.failOpen)
+			}
+			args := []string{msgFile}
+			if tt.flag {
+				args = []string{"--profile", "strict", msgFile}
+			} else {
+				runGit(t, "config", "ai-commit.profile", "strict")
+			}
+			if tt.missing {
+				args[len(args)-1] = filepath.Join(t.TempDir(), "missing")
+			} else if err := os.WriteFile(msgFile, []byte("# comment\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			err := runPrepareCommitMsg(args)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			var closed *failClosedError
+			if got := errors.As(err, &closed); got != tt.wantClosed {
+				t.Errorf("fail closed = %v, want %v (err: %v)", got, tt.wantClosed, err)
+			}
+			if n := requests.Load(); n != 0 {
+				t.Errorf("%d requests, want 0", n)
+			}
+		})
+	}
+}
+
+func TestShowNoCache(t *testing.T) {
+	_, requests := hookRepo(t, "feat: add main package")
+	runGit(t, "config", "ai-commit.cache", "true")
+
+	for _, run := range []struct {
+		args         []string
+		wantRequests int32
+	}{
+		{nil, 1},                    // nothing cached yet
+		{nil, 1},                    // answered from the cache
+		{[]string{"--no-cache"}, 2}, // asks again
+		{nil, 2},                    // the new message was cached
+	} {
+		var out string
+		stderr, err := captureStderr(t, func() error {
+			var err error
+			out, err = captureStdout(t, func() error { return runShow(run.args) })
+			return err
+		})
+		if err != nil {
+			t.Fatalf("show %v: %v\n%s", run.args, err, stderr)
+		}
+		if out != "feat: add main package\n" {
+			t.Errorf("show %v printed %q", run.args, out)
+		}
+		if n := requests.Load(); n != run.wantRequests {
+			t.Errorf("after show %v: %d requests, want %d", run.args, n, run.wantRequests)
+		}
+	}
+}
+
+func TestConfigGetSetMultiValued(t *testing.T) {
+	isolateGit(t)
+	runGit(t, "init", "-q", "-b", "main")
+	set := func(key, value string) string {
+		t.Helper()
+		out, err := captureStdout(t, func() error { return runConfigGetSet("set", []string{"--local", key, value}) })
+		if err != nil {
+			t.Fatalf("config set %s: %v", key, err)
+		}
+		return out
+	}
+	get := func(key string) string {
+		t.Helper()
+		out, err := captureStdout(t, func() error { return runConfigGetSet("get", []string{key}) })
+		if err != nil {
+			t.Fatalf("config get %s: %v", key, err)
+		}
+		return out
+	}
+
+	for _, key := range []string{"stop", "bannedPhrases", "disclaimerPattern", "header.X-Org-Id", "profiles.work.stop"} {
+		t.Run(key, func(t *testing.T) {
+			if out := set(key, "one"); !strings.Contains(out, " --add ") {
+				t.Errorf("set printed %q, want a git config --add command", out)
+			}
+			set(key, "two")
+			if got := get(key); got != "one\ntwo\n" {
+				t.Errorf("get = %q, want both values", got)
+			}
+		})
+	}
+
+	set("model", "gpt-4o")
+	set("model", "llama3")
+	if got := get("model"); got != "llama3\n" {
+		t.Errorf("get model = %q, want the value to be replaced", got)
+	}
+}